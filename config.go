@@ -1,98 +1,590 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	ini "github.com/dlintw/goconf"
+	"github.com/go-sql-driver/mysql"
+	"github.com/hgfischer/mysqlsuperdump/dumper"
 )
 
 // UseStdout means that if the flag `output` have this value, the dump will be written to the Stdout
 const UseStdout = "-"
 
+// Commands, given before the config file. Dump is the default one.
+const (
+	CommandDump     = "dump"
+	CommandValidate = "validate"
+	CommandScan     = "scan"
+	CommandConvert  = "convert"
+	CommandCopy     = "copy"
+)
+
 type config struct {
+	dsn                 string
+	postgresDSN         string
+	targetDSN           string
+	target              *mysql.Config
+	copyWorkers         int
+	copyMethod          string
+	maxOpenConns        int
+	output              string
+	file                string
+	command             string
+	verbose             bool
+	logLevel            string
+	logFormat           string
+	logFile             string
+	selectMap           map[string]map[string]string
+	whereMap            map[string]string
+	filterMap           map[string]string
+	sampleMap           map[string]int
+	insertRowsMap       map[string]int
+	useTableLock        bool
+	extendedInsRows     int
+	chunkSize           int
+	retry               dumper.RetryPolicy
+	policy              *dumper.Policy
+	checkpoint          string
+	resume              bool
+	progress            bool
+	report              string
+	metricsAddr         string
+	metricsPushURL      string
+	dryRun              bool
+	scanRows            int
+	fileHash            string
+	profile             string
+	profileFound        bool
+	interpolate         bool
+	hash                hash.Hash
+	parsing             map[string]bool
+	defaultsFile        string
+	defaultsGroupSuffix string
+	noDefaults          bool
+	passwordFile        string
+	mysql               *mysql.Config
+	format              string
+	dataDir             string
+	csvDelimiter        string
+	csvQuote            string
+	csvNull             string
+	rowGroupSize        int
+	splitSize           int
+	compression         string
+	binary              string
+	tables              []string
+	excludeTables       []string
+	overrides           overrides
+	flags               *flag.FlagSet
+	cfg                 *ini.ConfigFile
+}
+
+// overrides are the flags taking precedence over the config file
+type overrides struct {
 	dsn             string
-	maxOpenConns    int
-	output          string
-	file            string
-	verbose         bool
-	selectMap       map[string]map[string]string
-	whereMap        map[string]string
-	filterMap       map[string]string
-	useTableLock    bool
+	targetDSN       string
 	extendedInsRows int
-	cfg             *ini.ConfigFile
+	useTableLock    bool
+	maxOpenConns    int
+	chunkSize       int
+	format          string
+	dataDir         string
+	splitSize       int
+	tables          string
+	excludeTables   string
+	where           listFlag
+	selects         listFlag
+	filters         listFlag
+}
+
+// listFlag is a flag that may be given many times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func newConfig() *config {
 	return &config{
-		whereMap:  make(map[string]string, 0),
-		selectMap: make(map[string]map[string]string, 0),
-		filterMap: make(map[string]string, 0),
+		flags:           flag.NewFlagSet(os.Args[0], flag.ExitOnError),
+		whereMap:        make(map[string]string, 0),
+		selectMap:       make(map[string]map[string]string, 0),
+		filterMap:       make(map[string]string, 0),
+		sampleMap:       make(map[string]int, 0),
+		insertRowsMap:   make(map[string]int, 0),
+		extendedInsRows: 100,
+		useTableLock:    true,
+		format:          "sql",
+		maxOpenConns:    50,
+		copyWorkers:     4,
+		copyMethod:      "insert",
+		retry: dumper.RetryPolicy{
+			MaxAttempts:     1,
+			InitialBackoff:  time.Second,
+			MaxBackoff:      30 * time.Second,
+			RetryableErrors: dumper.DefaultRetryableErrors,
+		},
 	}
 }
 
 func (c *config) usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [flags] [config file]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] [command] [config file]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  %-10s Dump the database (default)\n", CommandDump)
+	fmt.Fprintf(os.Stderr, "  %-10s Check the config against the live schema\n", CommandValidate)
+	fmt.Fprintf(os.Stderr, "  %-10s Sample the tables and suggest [select] rules masking personal data\n", CommandScan)
+	fmt.Fprintf(os.Stderr, "  %-10s Convert the config file to YAML\n", CommandConvert)
+	fmt.Fprintf(os.Stderr, "  %-10s Copy the database into the [target] one, without a dump file\n", CommandCopy)
 	fmt.Fprintf(os.Stderr, "\nFlags:\n")
-	flag.PrintDefaults()
+	c.flags.PrintDefaults()
 	os.Exit(1)
 }
 
-func (c *config) parseAll() (err error) {
-	if err = c.parseCommandLine(); err != nil {
+// parseAll parses the command line arguments, without the program name, and
+// the config file. Flags override the config file and its profile.
+func (c *config) parseAll(args []string) (err error) {
+	if err = c.parseCommandLine(args); err != nil {
 		return
 	}
 	if err = c.parseConfigFile(); err != nil {
 		return
 	}
+	if err = c.applyOverrides(); err != nil {
+		return
+	}
+	c.fileHash = hex.EncodeToString(c.hash.Sum(nil))
+	// The -dsn flag counts as much as the dsn option
+	if c.command != CommandConvert && c.postgresDSN == "" {
+		if c.mysql, err = c.mysqlConfig(); err != nil {
+			return
+		}
+	}
+	if c.postgresDSN != "" && c.command != CommandConvert {
+		if err = c.checkPostgres(); err != nil {
+			return
+		}
+	}
+	if c.command == CommandCopy {
+		err = c.checkCopy()
+	}
+	if c.splitSize > 0 && c.command == CommandDump && err == nil {
+		err = c.checkSplit()
+	}
+	return
+}
+
+// checkSplit refuses the options that need the dump in a single file
+func (c *config) checkSplit() error {
+	switch {
+	case c.output == UseStdout:
+		return errors.New("Splitting the output requires the -o flag")
+	case c.format == "xml" || c.format == "sqlite" || c.format == "postgres":
+		return errors.New("The " + c.format + " format can't be split, as it must be loaded in one piece")
+	case c.resume:
+		return errors.New("The -resume flag is not supported with a split output")
+	case c.checkpoint != "":
+		// Checkpoints are offsets in a single file
+		return errors.New("The -checkpoint flag is not supported with a split output")
+	}
+	return nil
+}
+
+// checkCopy checks the [target] section and refuses the options of dumps
+func (c *config) checkCopy() (err error) {
+	switch {
+	case c.targetDSN == "":
+		return errors.New("Missing dsn option of the target section in " + c.file)
+	case c.copyWorkers < 1:
+		return errors.New("Invalid workers option of the target section, expected at least 1: " + strconv.Itoa(c.copyWorkers))
+	case c.copyMethod != "insert" && c.copyMethod != "loaddata":
+		return errors.New("Invalid method option of the target section, expected insert or loaddata: " + c.copyMethod)
+	case c.dryRun:
+		return errors.New("The -dry-run flag is not supported by the copy command")
+	case c.checkpoint != "":
+		return errors.New("The -checkpoint flag is not supported by the copy command")
+	case c.format != "sql":
+		return errors.New("The " + c.format + " format is not supported by the copy command")
+	case c.useTableLock && c.maxOpenConns > 0 && c.maxOpenConns < 2*c.copyWorkers:
+		// Each worker holds a connection locking its table while it reads
+		// the table through another one
+		return errors.New("The copy command with use_table_lock needs max_open_conns of at least twice the workers: " +
+			strconv.Itoa(2*c.copyWorkers))
+	}
+	c.target, err = mysql.ParseDSN(c.targetDSN)
 	return
 }
 
-func (c *config) getVerboseLogger() *log.Logger {
-	w := ioutil.Discard
-	if c.verbose {
-		w = os.Stdout
+// copyOptions returns the options of the copy command
+func (c *config) copyOptions() dumper.CopyOptions {
+	return dumper.CopyOptions{Workers: c.copyWorkers, LoadData: c.copyMethod == "loaddata"}
+}
+
+// checkPostgres refuses the options that need a MySQL source
+func (c *config) checkPostgres() error {
+	var option string
+	switch {
+	case c.command != CommandDump:
+		option = "The " + c.command + " command"
+	case c.dryRun:
+		option = "The -dry-run flag"
+	case c.checkpoint != "":
+		option = "The -checkpoint flag"
+	case c.report != "":
+		option = "The -report flag"
+	case c.chunkSize > 0:
+		option = "The chunk_size option"
+	case c.policy != nil:
+		option = "The policy section"
+	case c.format != "sql":
+		option = "The " + c.format + " format"
+	case c.splitSize > 0:
+		option = "The split_size option"
+	default:
+		return nil
+	}
+	return errors.New(option + " is not supported with a PostgreSQL source")
+}
+
+// getLogger returns the leveled logger, writing text or JSON records to stderr
+// or to the log file. Logs never go to stdout, where the dump may be written.
+func (c *config) getLogger() (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.logLevel)); err != nil {
+		return nil, err
+	}
+	if c.verbose && level > slog.LevelInfo {
+		level = slog.LevelInfo
+	}
+	var w io.Writer = os.Stderr
+	if c.logFile != "" {
+		f, err := os.OpenFile(c.logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch c.logFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, errors.New("Invalid log format: " + c.logFormat)
+}
+
+// getFormat returns the format of the data files, or nil when the data goes
+// to the dump
+func (c *config) getFormat() (dumper.Format, error) {
+	switch c.format {
+	case "sql", "xml", "sqlite", "postgres":
+		return nil, nil
+	case "csv", "tsv":
+		f := dumper.NewCSV()
+		if c.format == "tsv" {
+			f.Delimiter = '\t'
+		}
+		switch delimiter := []rune(c.csvDelimiter); {
+		case c.csvDelimiter == "":
+		case c.csvDelimiter == `\t`:
+			f.Delimiter = '\t'
+		case len(delimiter) == 1:
+			f.Delimiter = delimiter[0]
+		default:
+			return nil, errors.New("Invalid delimiter, expected a single character: " + c.csvDelimiter)
+		}
+		switch c.csvQuote {
+		case "", "minimal":
+		case "all":
+			f.QuoteAll = true
+		default:
+			return nil, errors.New("Invalid quote option, expected minimal or all: " + c.csvQuote)
+		}
+		f.Null = c.csvNull
+		return f, nil
+	case "jsonl":
+		return dumper.NewJSONLines(), nil
+	case "loaddata":
+		return dumper.NewLoadData(), nil
+	case "parquet":
+		f := dumper.NewParquet()
+		if c.rowGroupSize > 0 {
+			f.RowGroupSize = int64(c.rowGroupSize) * 1024 * 1024
+		}
+		if c.compression != "" {
+			f.Compression = c.compression
+		}
+		return f, f.CheckCompression()
+	}
+	return nil, errors.New("Invalid format, expected sql, xml, sqlite, postgres, csv, tsv, jsonl, parquet or loaddata: " + c.format)
+}
+
+// getDialect returns the dialect of the dump, or nil for MySQL statements
+func (c *config) getDialect() (dumper.Dialect, error) {
+	switch c.format {
+	case "xml":
+		x := dumper.NewXML()
+		switch c.binary {
+		case "", "base64":
+		case "hex":
+			x.Hex = true
+		default:
+			return nil, errors.New("Invalid binary option, expected base64 or hex: " + c.binary)
+		}
+		return x, nil
+	case "sqlite":
+		return dumper.NewSQLite(), nil
+	case "postgres":
+		return dumper.NewPostgreSQL(), nil
+	}
+	return nil, nil
+}
+
+// getDataDir returns the directory of the data files. By default, it's the
+// directory of the output file, or the current one when dumping to stdout.
+func (c *config) getDataDir() string {
+	if c.dataDir != "" || c.output == UseStdout {
+		return c.dataDir
 	}
-	return log.New(w, "mysqlsuperdump: ", log.LstdFlags|log.Lshortfile|log.Lmicroseconds)
+	return filepath.Dir(c.output)
 }
 
-func (c *config) parseCommandLine() (err error) {
-	flag.Usage = c.usage
-	flag.StringVar(&(c.output), "o", UseStdout, "Output path. Default is stdout")
-	flag.BoolVar(&(c.verbose), "v", false, "Enable printing status information")
-	flag.Parse()
-	if flag.NArg() != 1 {
-		flag.Usage()
+// getProgress returns the progress reporter writing to stderr, or nil if disabled.
+// Outside a terminal, like in CI logs, a new line is printed every 30 seconds.
+func (c *config) getProgress() *dumper.Progress {
+	if !c.progress {
+		return nil
+	}
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		return dumper.NewProgress(os.Stderr, true, 500*time.Millisecond)
+	}
+	return dumper.NewProgress(os.Stderr, false, 30*time.Second)
+}
+
+func (c *config) parseCommandLine(args []string) (err error) {
+	c.flags.Usage = c.usage
+	c.flags.StringVar(&(c.output), "o", UseStdout, "Output path. Default is stdout")
+	c.flags.BoolVar(&(c.verbose), "v", false, "Enable printing status information. Same as -log-level info")
+	c.flags.StringVar(&(c.logLevel), "log-level", "warn", "Log level: debug, info, warn or error")
+	c.flags.StringVar(&(c.logFormat), "log-format", "text", "Log format: text or json")
+	c.flags.StringVar(&(c.logFile), "log-file", "", "Log file path. Default is stderr")
+	c.flags.BoolVar(&(c.dryRun), "dry-run", false, "Print the tables, queries and estimates to stdout, without dumping")
+	c.flags.StringVar(&(c.defaultsFile), "defaults-file", "", "Read only this MySQL option file, instead of the default ones")
+	c.flags.StringVar(&(c.defaultsGroupSuffix), "defaults-group-suffix", "", "Also read the MySQL option groups with this suffix, like [client_staging]")
+	c.flags.BoolVar(&(c.noDefaults), "no-defaults", false, "Don't read MySQL option files")
+	c.flags.StringVar(&(c.passwordFile), "password-file", "", "Read the MySQL password from this file")
+	c.flags.StringVar(&(c.overrides.dsn), "dsn", "", "MySQL DSN, overriding the config file")
+	c.flags.StringVar(&(c.overrides.targetDSN), "target-dsn", "", "MySQL DSN of the copy target, overriding the config file")
+	c.flags.IntVar(&(c.overrides.extendedInsRows), "extended-insert-rows", 100, "Rows per INSERT, overriding the config file")
+	c.flags.BoolVar(&(c.overrides.useTableLock), "table-lock", true, "Lock tables while dumping, overriding the config file")
+	c.flags.IntVar(&(c.overrides.maxOpenConns), "max-open-conns", 50, "Maximum MySQL connections, overriding the config file")
+	c.flags.IntVar(&(c.overrides.chunkSize), "chunk-size", 0, "Rows per chunk, overriding the config file")
+	c.flags.StringVar(&(c.overrides.format), "format", "sql", "Output format: sql, xml, sqlite or postgres for the whole dump, or csv, tsv, jsonl, parquet or loaddata for data files of each table")
+	c.flags.StringVar(&(c.overrides.dataDir), "data-dir", "", "Directory of the data files. Default is the output directory")
+	c.flags.IntVar(&(c.overrides.splitSize), "split-size", 0, "Split the output in parts of this many MB, overriding the config file")
+	c.flags.Var(&(c.overrides.where), "where", "WHERE rule like table=expr. May be repeated")
+	c.flags.Var(&(c.overrides.selects), "select", "SELECT rule like table.column=expr. May be repeated")
+	c.flags.Var(&(c.overrides.filters), "filter", "Filter like table=nodata or table=ignore. May be repeated")
+	c.flags.StringVar(&(c.overrides.tables), "tables", "", "Comma separated tables to dump, others are ignored. Accepts * patterns")
+	c.flags.StringVar(&(c.overrides.excludeTables), "exclude-tables", "", "Comma separated tables to ignore. Accepts * patterns")
+	c.flags.StringVar(&(c.profile), "profile", "", "Config profile applied over the base options, like staging")
+	c.flags.IntVar(&(c.scanRows), "scan-rows", 100, "Rows sampled from each table by the scan command")
+	c.flags.StringVar(&(c.checkpoint), "checkpoint", "", "Save a checkpoint to this path, to resume an interrupted dump. Default with -resume is the output path plus .checkpoint")
+	c.flags.BoolVar(&(c.resume), "resume", false, "Resume an interrupted dump from its checkpoint")
+	c.flags.BoolVar(&(c.progress), "progress", false, "Report progress, rates and ETA to stderr")
+	c.flags.StringVar(&(c.report), "report", "", "Path of a JSON report of what was dumped")
+	c.flags.StringVar(&(c.metricsAddr), "metrics-addr", "", "Address to expose Prometheus metrics at, like :9090")
+	c.flags.StringVar(&(c.metricsPushURL), "metrics-push-url", "", "Pushgateway URL to push the metrics to at the end")
+	if err = c.flags.Parse(args); err != nil {
+		return
+	}
+	switch c.flags.NArg() {
+	case 1:
+		c.command, c.file = CommandDump, c.flags.Arg(0)
+	case 2:
+		c.command, c.file = c.flags.Arg(0), c.flags.Arg(1)
+	default:
+		c.flags.Usage()
 		return errors.New("Missing parameters")
 	}
-	c.file = flag.Arg(0)
+	switch c.command {
+	case CommandDump, CommandValidate, CommandScan, CommandConvert, CommandCopy:
+	default:
+		c.flags.Usage()
+		return errors.New("Unknown command: " + c.command)
+	}
+	// Converted configs keep their ${...} references, so no secret is written
+	c.interpolate = c.command != CommandConvert
+	// Checkpoints are only saved when asked for, or needed to resume
+	if c.resume && c.checkpoint == "" && c.output != UseStdout && c.command == CommandDump {
+		c.checkpoint = c.output + ".checkpoint"
+	}
+	if c.resume && c.checkpoint == "" {
+		return errors.New("Resuming a dump to stdout requires the -checkpoint flag")
+	}
 	return
 }
 
+// parseConfigFile parses the config file, its includes and its profile. The
+// file hash covers all of them, and the overriding flags once applied, so
+// resuming a dump refuses any change.
 func (c *config) parseConfigFile() (err error) {
-	if c.cfg, err = ini.ReadConfigFile(c.file); err != nil {
+	c.hash = sha256.New()
+	c.parsing = make(map[string]bool)
+	if err = c.parseFile(c.file); err != nil {
+		return
+	}
+	if c.profile != "" {
+		if !c.profileFound {
+			return errors.New("Profile not found in config: " + c.profile)
+		}
+		io.WriteString(c.hash, "profile "+c.profile)
+	}
+	return
+}
+
+// parseFile parses the files included by file, then the file itself and its
+// profile. Each one only overrides the options it sets.
+func (c *config) parseFile(file string) (err error) {
+	if c.parsing[file] {
+		return errors.New("Config file includes itself: " + file)
+	}
+	c.parsing[file] = true
+	defer delete(c.parsing, file)
+	var data []byte
+	if data, err = ioutil.ReadFile(file); err != nil {
 		return
 	}
-	if c.dsn, err = c.cfg.GetString("mysql", "dsn"); err != nil {
+	c.hash.Write(data)
+	if isYAML(file) {
+		return c.parseYAML(file, data)
+	}
+	return c.parseINI(file)
+}
+
+// parseIncludes parses the included files, relative to the including one
+func (c *config) parseIncludes(file string, includes []string) error {
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(file), include)
+		}
+		if err := c.parseFile(include); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseINI parses an INI file. Includes are listed before any section, and
+// the sections of a profile are named like [where:staging].
+func (c *config) parseINI(file string) (err error) {
+	cfg, err := ini.ReadConfigFile(file)
+	if err != nil {
 		return
 	}
-	if c.extendedInsRows, err = c.cfg.GetInt("mysql", "extended_insert_rows"); err != nil {
-		c.extendedInsRows = 100
+	if err = c.interpolateINI(cfg); err != nil {
+		return
 	}
-	if c.useTableLock, err = c.cfg.GetBool("mysql", "use_table_lock"); err != nil {
-		c.useTableLock = true
+	if include, err := cfg.GetRawString(ini.DefaultSection, "include"); err == nil {
+		if err = c.parseIncludes(file, splitList(include)); err != nil {
+			return err
+		}
 	}
-	if c.maxOpenConns, err = c.cfg.GetInt("mysql", "max_open_conns"); err != nil {
-		c.maxOpenConns = 50
+	c.cfg = cfg
+	if err = c.applyINI(""); err != nil || c.profile == "" {
+		return
+	}
+	suffix := ":" + c.profile
+	for _, section := range cfg.GetSections() {
+		if strings.HasSuffix(strings.ToLower(section), strings.ToLower(suffix)) {
+			c.profileFound = true
+		}
+	}
+	return c.applyINI(suffix)
+}
+
+// interpolateINI replaces the ${...} references in all values
+func (c *config) interpolateINI(cfg *ini.ConfigFile) error {
+	if !c.interpolate {
+		return nil
 	}
+	for _, section := range cfg.GetSections() {
+		options, err := cfg.GetOptions(section)
+		if err != nil {
+			return err
+		}
+		for _, option := range options {
+			value, err := cfg.GetRawString(section, option)
+			if err != nil || !strings.Contains(value, "${") {
+				continue
+			}
+			if value, err = interpolate(value); err != nil {
+				return err
+			}
+			cfg.AddOption(section, option, value)
+		}
+	}
+	return nil
+}
+
+// applyINI applies the options of the sections named with suffix
+func (c *config) applyINI(suffix string) (err error) {
+	mysql := "mysql" + suffix
+	c.setString(mysql, "dsn", &c.dsn)
+	c.setInt(mysql, "extended_insert_rows", &c.extendedInsRows)
+	if value, err := c.cfg.GetBool(mysql, "use_table_lock"); err == nil {
+		c.useTableLock = value
+	}
+	c.setInt(mysql, "max_open_conns", &c.maxOpenConns)
+	c.setInt(mysql, "chunk_size", &c.chunkSize)
+	if err = c.parseRetryPolicy(mysql); err != nil {
+		return
+	}
+	postgres := "postgres" + suffix
+	c.setString(postgres, "dsn", &c.postgresDSN)
+	if value, err := c.cfg.GetBool(postgres, "use_table_lock"); err == nil {
+		c.useTableLock = value
+	}
+	c.setInt(postgres, "max_open_conns", &c.maxOpenConns)
+	target := "target" + suffix
+	c.setString(target, "dsn", &c.targetDSN)
+	c.setInt(target, "workers", &c.copyWorkers)
+	c.setString(target, "method", &c.copyMethod)
+	if err = c.parsePolicy("policy" + suffix); err != nil {
+		return
+	}
+	output := "output" + suffix
+	c.setString(output, "format", &c.format)
+	c.setString(output, "dir", &c.dataDir)
+	c.setString(output, "delimiter", &c.csvDelimiter)
+	c.setString(output, "quote", &c.csvQuote)
+	c.setString(output, "null", &c.csvNull)
+	c.setInt(output, "row_group_size", &c.rowGroupSize)
+	c.setInt(output, "split_size", &c.splitSize)
+	c.setString(output, "compression", &c.compression)
+	c.setString(output, "binary", &c.binary)
 	var selects []string
-	if selects, err = c.cfg.GetOptions("select"); err != nil {
+	if selects, err = c.options("select" + suffix); err != nil {
 		return
 	}
 	for _, tableCol := range selects {
@@ -103,23 +595,127 @@ func (c *config) parseConfigFile() (err error) {
 		if c.selectMap[table] == nil {
 			c.selectMap[table] = make(map[string]string, 0)
 		}
-		if c.selectMap[table][column], err = c.cfg.GetString("select", tableCol); err != nil {
+		if c.selectMap[table][column], err = c.cfg.GetString("select"+suffix, tableCol); err != nil {
 			return
 		}
 	}
-	if c.loadOptions("where", c.whereMap); err != nil {
+	if err = c.loadOptions("where"+suffix, c.whereMap); err != nil {
 		return
 	}
-	if c.loadOptions("filter", c.filterMap); err != nil {
+	if err = c.loadOptions("filter"+suffix, c.filterMap); err != nil {
 		return
 	}
 	return
 }
 
+func (c *config) parseRetryPolicy(section string) (err error) {
+	c.setInt(section, "retry_attempts", &c.retry.MaxAttempts)
+	if value, err := c.getDuration(section, "retry_backoff"); err == nil {
+		c.retry.InitialBackoff = value
+	}
+	if value, err := c.getDuration(section, "retry_max_backoff"); err == nil {
+		c.retry.MaxBackoff = value
+	}
+	var numbers string
+	if numbers, err = c.cfg.GetString(section, "retry_errors"); err != nil {
+		return nil
+	}
+	c.retry.RetryableErrors = nil
+	for _, number := range strings.Split(numbers, ",") {
+		var n uint64
+		if n, err = strconv.ParseUint(strings.TrimSpace(number), 10, 16); err != nil {
+			return errors.New("Invalid MySQL error number in retry_errors: " + number)
+		}
+		c.retry.RetryableErrors = append(c.retry.RetryableErrors, uint16(n))
+	}
+	return nil
+}
+
+// parsePolicy reads the optional [policy] section of sensitive columns
+func (c *config) parsePolicy(section string) error {
+	if !c.cfg.HasSection(section) {
+		return nil
+	}
+	if c.policy == nil {
+		c.policy = &dumper.Policy{}
+	}
+	c.setList(section, "columns", &c.policy.Columns)
+	c.setList(section, "types", &c.policy.Types)
+	c.setList(section, "allow", &c.policy.Allow)
+	var mode string
+	c.setString(section, "mode", &mode)
+	switch mode {
+	case "":
+	case "fail":
+		c.policy.Warn = false
+	case "warn":
+		c.policy.Warn = true
+	default:
+		return errors.New("Invalid policy mode, expected fail or warn: " + mode)
+	}
+	return nil
+}
+
+// The setters below only change the value if the option is set, keeping the
+// defaults and the values of included files otherwise
+
+func (c *config) setString(section, option string, value *string) {
+	if v, err := c.cfg.GetString(section, option); err == nil {
+		*value = v
+	}
+}
+
+func (c *config) setInt(section, option string, value *int) {
+	if v, err := c.cfg.GetInt(section, option); err == nil {
+		*value = v
+	}
+}
+
+// setList sets the comma separated values of an option
+func (c *config) setList(section, option string, list *[]string) {
+	if value, err := c.cfg.GetString(section, option); err == nil {
+		*list = splitList(value)
+	}
+}
+
+func splitList(value string) (list []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+func (c *config) getDuration(section, option string) (time.Duration, error) {
+	value, err := c.cfg.GetString(section, option)
+	if err != nil {
+		return 0, err
+	}
+	return time.ParseDuration(value)
+}
+
+// options returns the options of a section, if it exists. Options set before
+// any section, like include, aren't part of it.
+func (c *config) options(section string) (options []string, err error) {
+	if !c.cfg.HasSection(section) {
+		return
+	}
+	var all []string
+	if all, err = c.cfg.GetOptions(section); err != nil {
+		return
+	}
+	for _, option := range all {
+		if !c.cfg.HasOption(ini.DefaultSection, option) {
+			options = append(options, option)
+		}
+	}
+	return
+}
+
 func (c *config) loadOptions(section string, optMap map[string]string) error {
-	var opts []string
-	var err error
-	if opts, err = c.cfg.GetOptions(section); err != nil {
+	opts, err := c.options(section)
+	if err != nil {
 		return err
 	}
 	for _, key := range opts {
@@ -130,6 +726,108 @@ func (c *config) loadOptions(section string, optMap map[string]string) error {
 	return nil
 }
 
+var reference = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// interpolate replaces ${NAME} in value with the environment variable NAME,
+// and ${file:path} with the contents of the file, like a Docker secret
+func interpolate(value string) (string, error) {
+	var err error
+	value = reference.ReplaceAllStringFunc(value, func(match string) string {
+		name := match[2 : len(match)-1]
+		if path := strings.TrimPrefix(name, "file:"); path != name {
+			data, readErr := ioutil.ReadFile(path)
+			if readErr != nil {
+				err = readErr
+				return ""
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			err = errors.New("Environment variable not set: " + name)
+		}
+		return env
+	})
+	return value, err
+}
+
+// applyOverrides applies the flags given in the command line over the config
+// file. Only flags actually given count, so their defaults don't override it.
+func (c *config) applyOverrides() (err error) {
+	c.flags.Visit(func(f *flag.Flag) {
+		o := &c.overrides
+		switch f.Name {
+		case "dsn":
+			c.dsn = o.dsn
+		case "target-dsn":
+			c.targetDSN = o.targetDSN
+		case "extended-insert-rows":
+			c.extendedInsRows = o.extendedInsRows
+		case "table-lock":
+			c.useTableLock = o.useTableLock
+		case "max-open-conns":
+			c.maxOpenConns = o.maxOpenConns
+		case "chunk-size":
+			c.chunkSize = o.chunkSize
+		case "format":
+			c.format = o.format
+		case "data-dir":
+			c.dataDir = o.dataDir
+		case "split-size":
+			c.splitSize = o.splitSize
+		case "tables":
+			c.tables = splitList(o.tables)
+		case "exclude-tables":
+			c.excludeTables = splitList(o.excludeTables)
+		case "where", "select", "filter":
+		default:
+			return
+		}
+		fmt.Fprintf(c.hash, "-%s=%s\n", f.Name, f.Value)
+	})
+	for _, where := range c.overrides.where {
+		var table, expr string
+		if table, expr, err = splitAssignment("where", where); err != nil {
+			return
+		}
+		c.whereMap[table] = expr
+	}
+	for _, selectRule := range c.overrides.selects {
+		var tableCol, expr, table, column string
+		if tableCol, expr, err = splitAssignment("select", selectRule); err != nil {
+			return
+		}
+		if table, column, err = c.splitTableColumn(tableCol); err != nil {
+			return
+		}
+		if c.selectMap[table] == nil {
+			c.selectMap[table] = make(map[string]string, 0)
+		}
+		c.selectMap[table][column] = expr
+	}
+	for _, filter := range c.overrides.filters {
+		var table, value string
+		if table, value, err = splitAssignment("filter", filter); err != nil {
+			return
+		}
+		c.filterMap[table] = value
+	}
+	return
+}
+
+// splitAssignment splits name=value flags, lowercasing the name like the
+// config file options
+func splitAssignment(flagName, assignment string) (name, value string, err error) {
+	i := strings.Index(assignment, "=")
+	if i < 1 {
+		err = errors.New("Expected -" + flagName + " 'name=value' format. Got wrong one:" + assignment)
+		return
+	}
+	name = strings.ToLower(strings.TrimSpace(assignment[:i]))
+	value = strings.TrimSpace(assignment[i+1:])
+	return
+}
+
 func (c *config) splitTableColumn(tableCol string) (table, column string, err error) {
 	split := strings.Split(tableCol, ".")
 	if len(split) != 2 {
@@ -141,9 +839,30 @@ func (c *config) splitTableColumn(tableCol string) (table, column string, err er
 	return
 }
 
-func (c *config) initOutput() (*os.File, error) {
+// initOutput opens the output. When resuming, the output file is truncated
+// where the checkpoint was saved, dropping any partial tail, and appended to.
+// Dumps with a split_size are written in parts, named after the output.
+func (c *config) initOutput(offset int64) (io.WriteCloser, error) {
 	if c.output == UseStdout {
 		return os.Stdout, nil
 	}
-	return os.Create(c.output)
+	if c.splitSize > 0 && c.command == CommandDump {
+		return dumper.NewSplitWriter(c.output, int64(c.splitSize)*1024*1024), nil
+	}
+	if !c.resume {
+		return os.Create(c.output)
+	}
+	f, err := os.OpenFile(c.output, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
 }
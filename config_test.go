@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles writes the files to a temporary directory, returning its path
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+// parseArgs parses the command line like main does, failing instead of exiting
+func parseArgs(args ...string) (*config, error) {
+	c := newConfig()
+	c.flags = flag.NewFlagSet("mysqlsuperdump", flag.ContinueOnError)
+	c.flags.SetOutput(ioutil.Discard)
+	return c, c.parseAll(args)
+}
+
+const precedenceINI = `include = base.cfg
+
+[mysql]
+dsn = file:secret@tcp(file:3306)/filedb
+extended_insert_rows = 10
+
+[mysql:staging]
+dsn = staging:secret@tcp(staging:3306)/stagingdb
+extended_insert_rows = 20
+
+[where]
+orders = id > 1
+customers = id > 2
+
+[where:staging]
+orders = id > 10
+`
+
+const precedenceYAML = `include: base.cfg
+mysql:
+  dsn: file:secret@tcp(file:3306)/filedb
+  extended_insert_rows: 10
+tables:
+  orders:
+    where: id > 1
+  customers:
+    where: id > 2
+profiles:
+  staging:
+    mysql:
+      dsn: staging:secret@tcp(staging:3306)/stagingdb
+      extended_insert_rows: 20
+    tables:
+      orders:
+        where: id > 10
+`
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"base.cfg":    "[mysql]\nextended_insert_rows = 5\nmax_open_conns = 7\n",
+		"config.cfg":  precedenceINI,
+		"config.yaml": precedenceYAML,
+	})
+	tests := []struct {
+		name         string
+		args         []string
+		addr, dbName string
+		rows         int
+		orders       string
+	}{
+		{"file", nil, "file:3306", "filedb", 10, "id > 1"},
+		{"profile", []string{"-profile", "staging"}, "staging:3306", "stagingdb", 20, "id > 10"},
+		{"flags", []string{"-profile", "staging", "-dsn", "flag:secret@tcp(flag:3306)/flagdb",
+			"-extended-insert-rows", "30", "-where", "orders=id > 100"}, "flag:3306", "flagdb", 30, "id > 100"},
+	}
+	for _, file := range []string{"config.cfg", "config.yaml"} {
+		for _, test := range tests {
+			t.Run(file+"/"+test.name, func(t *testing.T) {
+				args := append(append([]string{"-no-defaults"}, test.args...), filepath.Join(dir, file))
+				c, err := parseArgs(args...)
+				assert.Nil(t, err)
+				assert.Equal(t, test.addr, c.mysql.Addr)
+				assert.Equal(t, test.dbName, c.mysql.DBName)
+				assert.Equal(t, test.rows, c.extendedInsRows)
+				assert.Equal(t, test.orders, c.whereMap["orders"])
+				// Options set by no one above keep the included, or default, value
+				assert.Equal(t, "id > 2", c.whereMap["customers"])
+				assert.Equal(t, 7, c.maxOpenConns)
+				assert.True(t, c.useTableLock)
+			})
+		}
+	}
+}
+
+func TestConfigDSNFlagWithoutDSNInFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"config.cfg": "[where]\norders = id > 1\n"})
+	c, err := parseArgs("-no-defaults", "-dsn", "user:secret@tcp(flag:3306)/db", filepath.Join(dir, "config.cfg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "flag:3306", c.mysql.Addr)
+	assert.Equal(t, "secret", c.mysql.Passwd)
+
+	_, err = parseArgs("-no-defaults", filepath.Join(dir, "config.cfg"))
+	assert.NotNil(t, err)
+}
+
+func TestConfigOptionFilesUnderDSN(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"my.cnf":     "[client]\nuser = backup\npassword = \"s3cret\"\nhost = db.internal\nport = 3307\ndatabase = other\n",
+		"config.cfg": "[mysql]\ndsn = /shop\n",
+	})
+	if password, ok := os.LookupEnv("MYSQL_PWD"); ok {
+		os.Unsetenv("MYSQL_PWD")
+		t.Cleanup(func() { os.Setenv("MYSQL_PWD", password) })
+	}
+	c, err := parseArgs("-defaults-file", filepath.Join(dir, "my.cnf"), filepath.Join(dir, "config.cfg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "backup", c.mysql.User)
+	assert.Equal(t, "s3cret", c.mysql.Passwd)
+	assert.Equal(t, "db.internal:3307", c.mysql.Addr)
+	assert.Equal(t, "shop", c.mysql.DBName)
+}
+
+func TestConfigEnvironmentPasswordComesLast(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"my.cnf":      "[client]\nuser = backup\npassword = from-file\n",
+		"config.cfg":  "[mysql]\ndsn = user:from-dsn@tcp(db:3306)/shop\n",
+		"nopass.cfg":  "[mysql]\ndsn = user@tcp(db:3306)/shop\n",
+		"options.cfg": "[mysql]\ndsn = /shop\n",
+	})
+	t.Setenv("MYSQL_PWD", "from-env")
+
+	c, err := parseArgs("-no-defaults", filepath.Join(dir, "config.cfg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "from-dsn", c.mysql.Passwd)
+
+	c, err = parseArgs("-defaults-file", filepath.Join(dir, "my.cnf"), filepath.Join(dir, "options.cfg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "from-file", c.mysql.Passwd)
+
+	c, err = parseArgs("-no-defaults", filepath.Join(dir, "nopass.cfg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", c.mysql.Passwd)
+}
+
+func TestConfigHashCoversFlags(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"config.cfg": "[mysql]\ndsn = user:secret@tcp(db:3306)/shop\n"})
+	file := filepath.Join(dir, "config.cfg")
+	plain, err := parseArgs("-no-defaults", file)
+	assert.Nil(t, err)
+	again, err := parseArgs("-no-defaults", file)
+	assert.Nil(t, err)
+	overridden, err := parseArgs("-no-defaults", "-where", "orders=id > 1", file)
+	assert.Nil(t, err)
+	assert.Equal(t, plain.fileHash, again.fileHash)
+	assert.NotEqual(t, plain.fileHash, overridden.fileHash)
+}
+
+func TestConfigCopyNeedsConnectionsForTableLocks(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.cfg": "[mysql]\ndsn = user:secret@tcp(db:3306)/shop\nmax_open_conns = 7\n\n" +
+			"[target]\ndsn = user:secret@tcp(copy:3306)/shop\nworkers = 4\n",
+	})
+	file := filepath.Join(dir, "config.cfg")
+	_, err := parseArgs("-no-defaults", "copy", file)
+	assert.NotNil(t, err)
+	_, err = parseArgs("-no-defaults", "-max-open-conns", "8", "copy", file)
+	assert.Nil(t, err)
+}
+
+func TestConfigCheckpointIsOptIn(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.cfg":   "[mysql]\ndsn = user:secret@tcp(db:3306)/shop\n",
+		"postgres.cfg": "[postgres]\ndsn = postgres://user:secret@db/shop\n",
+	})
+	output := filepath.Join(dir, "dump.sql")
+	file := filepath.Join(dir, "config.cfg")
+	c, err := parseArgs("-no-defaults", "-o", output, file)
+	assert.Nil(t, err)
+	assert.Empty(t, c.checkpoint)
+
+	c, err = parseArgs("-no-defaults", "-o", output, "-resume", file)
+	assert.Nil(t, err)
+	assert.Equal(t, output+".checkpoint", c.checkpoint)
+
+	c, err = parseArgs("-no-defaults", "-o", output, "-checkpoint", filepath.Join(dir, "cp"), file)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "cp"), c.checkpoint)
+
+	_, err = parseArgs("-no-defaults", "-o", output, filepath.Join(dir, "postgres.cfg"))
+	assert.Nil(t, err)
+}
+
+func TestConfigSplitRefusesCheckpoint(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config.cfg": "[mysql]\ndsn = user:secret@tcp(db:3306)/shop\n\n[output]\nsplit_size = 100\n",
+	})
+	output := filepath.Join(dir, "dump.sql")
+	file := filepath.Join(dir, "config.cfg")
+	_, err := parseArgs("-no-defaults", "-o", output, file)
+	assert.Nil(t, err)
+	_, err = parseArgs("-no-defaults", "-o", output, "-checkpoint", output+".checkpoint", file)
+	assert.EqualError(t, err, "The -checkpoint flag is not supported with a split output")
+}
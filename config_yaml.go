@@ -0,0 +1,355 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hgfischer/mysqlsuperdump/dumper"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlConfig is the structured config format. Unlike the INI one, table and
+// column names may have dots and SQL expressions may span multiple lines.
+type yamlConfig struct {
+	// Include lists the files parsed before this one, which overrides them
+	Include  stringList             `yaml:"include,omitempty"`
+	MySQL    yamlMySQL              `yaml:"mysql"`
+	Postgres *yamlPostgres          `yaml:"postgres,omitempty"`
+	Target   *yamlTarget            `yaml:"target,omitempty"`
+	Policy   *yamlPolicy            `yaml:"policy,omitempty"`
+	Output   *yamlOutput            `yaml:"output,omitempty"`
+	Tables   map[string]*yamlTable  `yaml:"tables,omitempty"`
+	Profiles map[string]*yamlConfig `yaml:"profiles,omitempty"`
+}
+
+// stringList is a list that may be given as a single string too
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(l))
+}
+
+// Options left out of the file are nil, keeping their defaults
+type yamlMySQL struct {
+	DSN                string     `yaml:"dsn,omitempty"`
+	ExtendedInsertRows *int       `yaml:"extended_insert_rows,omitempty"`
+	UseTableLock       *bool      `yaml:"use_table_lock,omitempty"`
+	MaxOpenConns       *int       `yaml:"max_open_conns,omitempty"`
+	ChunkSize          *int       `yaml:"chunk_size,omitempty"`
+	Retry              *yamlRetry `yaml:"retry,omitempty"`
+}
+
+// yamlPostgres makes PostgreSQL the source of the dump
+type yamlPostgres struct {
+	DSN          string `yaml:"dsn,omitempty"`
+	UseTableLock *bool  `yaml:"use_table_lock,omitempty"`
+	MaxOpenConns *int   `yaml:"max_open_conns,omitempty"`
+}
+
+// yamlTarget is the database written by the copy command
+type yamlTarget struct {
+	DSN     string `yaml:"dsn,omitempty"`
+	Workers int    `yaml:"workers,omitempty"`
+	// Method is insert or loaddata
+	Method string `yaml:"method,omitempty"`
+}
+
+type yamlRetry struct {
+	Attempts   *int           `yaml:"attempts,omitempty"`
+	Backoff    *time.Duration `yaml:"backoff,omitempty"`
+	MaxBackoff *time.Duration `yaml:"max_backoff,omitempty"`
+	Errors     []uint16       `yaml:"errors,omitempty"`
+}
+
+type yamlPolicy struct {
+	Mode    string   `yaml:"mode,omitempty"`
+	Columns []string `yaml:"columns,omitempty"`
+	Types   []string `yaml:"types,omitempty"`
+	Allow   []string `yaml:"allow,omitempty"`
+}
+
+type yamlOutput struct {
+	// Format is sql, xml, sqlite, postgres, csv, tsv, jsonl, parquet or loaddata
+	Format    string  `yaml:"format,omitempty"`
+	Dir       string  `yaml:"dir,omitempty"`
+	Delimiter string  `yaml:"delimiter,omitempty"`
+	Quote     string  `yaml:"quote,omitempty"`
+	Null      *string `yaml:"null,omitempty"`
+	// RowGroupSize is in MB
+	RowGroupSize int    `yaml:"row_group_size,omitempty"`
+	Compression  string `yaml:"compression,omitempty"`
+	// SplitSize is the size in MB of the parts of the dump
+	SplitSize int `yaml:"split_size,omitempty"`
+	// Binary is the encoding of binary data in XML, base64 or hex
+	Binary string `yaml:"binary,omitempty"`
+}
+
+type yamlTable struct {
+	// Filter is ignore or nodata
+	Filter string `yaml:"filter,omitempty"`
+	Where  string `yaml:"where,omitempty"`
+	// Columns maps column names to the SQL expressions replacing them
+	Columns map[string]string `yaml:"columns,omitempty"`
+	// Sample is the maximum number of rows dumped
+	Sample             int `yaml:"sample,omitempty"`
+	ExtendedInsertRows int `yaml:"extended_insert_rows,omitempty"`
+}
+
+func isYAML(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func (c *config) parseYAML(file string, data []byte) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	if err := c.interpolateYAML(&node); err != nil {
+		return err
+	}
+	var y yamlConfig
+	if err := node.Decode(&y); err != nil {
+		return err
+	}
+	if err := c.parseIncludes(file, y.Include); err != nil {
+		return err
+	}
+	if err := c.applyYAML(&y); err != nil || c.profile == "" {
+		return err
+	}
+	if profile := y.Profiles[c.profile]; profile != nil {
+		c.profileFound = true
+		return c.applyYAML(profile)
+	}
+	return nil
+}
+
+// interpolateYAML replaces the ${...} references in all scalar values
+func (c *config) interpolateYAML(node *yaml.Node) (err error) {
+	if !c.interpolate {
+		return
+	}
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		node.Value, err = interpolate(node.Value)
+		return
+	}
+	for _, child := range node.Content {
+		if err = c.interpolateYAML(child); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// applyYAML only overrides the options set in y
+func (c *config) applyYAML(y *yamlConfig) error {
+	if y.MySQL.DSN != "" {
+		c.dsn = y.MySQL.DSN
+	}
+	if y.MySQL.ExtendedInsertRows != nil {
+		c.extendedInsRows = *y.MySQL.ExtendedInsertRows
+	}
+	if y.MySQL.UseTableLock != nil {
+		c.useTableLock = *y.MySQL.UseTableLock
+	}
+	if y.MySQL.MaxOpenConns != nil {
+		c.maxOpenConns = *y.MySQL.MaxOpenConns
+	}
+	if y.MySQL.ChunkSize != nil {
+		c.chunkSize = *y.MySQL.ChunkSize
+	}
+	if p := y.Postgres; p != nil {
+		if p.DSN != "" {
+			c.postgresDSN = p.DSN
+		}
+		if p.UseTableLock != nil {
+			c.useTableLock = *p.UseTableLock
+		}
+		if p.MaxOpenConns != nil {
+			c.maxOpenConns = *p.MaxOpenConns
+		}
+	}
+	if t := y.Target; t != nil {
+		if t.DSN != "" {
+			c.targetDSN = t.DSN
+		}
+		if t.Workers > 0 {
+			c.copyWorkers = t.Workers
+		}
+		if t.Method != "" {
+			c.copyMethod = t.Method
+		}
+	}
+	if r := y.MySQL.Retry; r != nil {
+		if r.Attempts != nil {
+			c.retry.MaxAttempts = *r.Attempts
+		}
+		if r.Backoff != nil {
+			c.retry.InitialBackoff = *r.Backoff
+		}
+		if r.MaxBackoff != nil {
+			c.retry.MaxBackoff = *r.MaxBackoff
+		}
+		if r.Errors != nil {
+			c.retry.RetryableErrors = r.Errors
+		}
+	}
+	if p := y.Policy; p != nil {
+		if c.policy == nil {
+			c.policy = &dumper.Policy{}
+		}
+		if p.Columns != nil {
+			c.policy.Columns = p.Columns
+		}
+		if p.Types != nil {
+			c.policy.Types = p.Types
+		}
+		if p.Allow != nil {
+			c.policy.Allow = p.Allow
+		}
+		switch p.Mode {
+		case "":
+		case "fail":
+			c.policy.Warn = false
+		case "warn":
+			c.policy.Warn = true
+		default:
+			return errors.New("Invalid policy mode, expected fail or warn: " + p.Mode)
+		}
+	}
+	if o := y.Output; o != nil {
+		if o.Format != "" {
+			c.format = o.Format
+		}
+		if o.Dir != "" {
+			c.dataDir = o.Dir
+		}
+		if o.Delimiter != "" {
+			c.csvDelimiter = o.Delimiter
+		}
+		if o.Quote != "" {
+			c.csvQuote = o.Quote
+		}
+		if o.Null != nil {
+			c.csvNull = *o.Null
+		}
+		if o.RowGroupSize > 0 {
+			c.rowGroupSize = o.RowGroupSize
+		}
+		if o.Compression != "" {
+			c.compression = o.Compression
+		}
+		if o.SplitSize > 0 {
+			c.splitSize = o.SplitSize
+		}
+		if o.Binary != "" {
+			c.binary = o.Binary
+		}
+	}
+	for name, t := range y.Tables {
+		if t == nil {
+			continue
+		}
+		table := strings.ToLower(name)
+		if t.Filter != "" {
+			c.filterMap[table] = t.Filter
+		}
+		if where := strings.TrimSpace(t.Where); where != "" {
+			c.whereMap[table] = where
+		}
+		for column, expr := range t.Columns {
+			if c.selectMap[table] == nil {
+				c.selectMap[table] = make(map[string]string, 0)
+			}
+			c.selectMap[table][strings.ToLower(column)] = strings.TrimSpace(expr)
+		}
+		if t.Sample > 0 {
+			c.sampleMap[table] = t.Sample
+		}
+		if t.ExtendedInsertRows > 0 {
+			c.insertRowsMap[table] = t.ExtendedInsertRows
+		}
+	}
+	return nil
+}
+
+// toYAML returns the parsed config in the YAML format
+func (c *config) toYAML() *yamlConfig {
+	y := &yamlConfig{
+		MySQL: yamlMySQL{
+			DSN:                c.dsn,
+			ExtendedInsertRows: &c.extendedInsRows,
+			UseTableLock:       &c.useTableLock,
+			MaxOpenConns:       &c.maxOpenConns,
+			Retry: &yamlRetry{
+				Attempts:   &c.retry.MaxAttempts,
+				Backoff:    &c.retry.InitialBackoff,
+				MaxBackoff: &c.retry.MaxBackoff,
+				Errors:     c.retry.RetryableErrors,
+			},
+		},
+		Tables: make(map[string]*yamlTable),
+	}
+	if c.chunkSize > 0 {
+		y.MySQL.ChunkSize = &c.chunkSize
+	}
+	if c.postgresDSN != "" {
+		y.Postgres = &yamlPostgres{DSN: c.postgresDSN}
+	}
+	if c.targetDSN != "" {
+		y.Target = &yamlTarget{DSN: c.targetDSN, Workers: c.copyWorkers, Method: c.copyMethod}
+	}
+	if c.policy != nil {
+		y.Policy = &yamlPolicy{Mode: "fail", Columns: c.policy.Columns, Types: c.policy.Types, Allow: c.policy.Allow}
+		if c.policy.Warn {
+			y.Policy.Mode = "warn"
+		}
+	}
+	if c.format != "sql" || c.dataDir != "" || c.splitSize > 0 {
+		y.Output = &yamlOutput{Format: c.format, Dir: c.dataDir, Delimiter: c.csvDelimiter, Quote: c.csvQuote,
+			RowGroupSize: c.rowGroupSize, Compression: c.compression, Binary: c.binary, SplitSize: c.splitSize}
+		if c.csvNull != "" {
+			y.Output.Null = &c.csvNull
+		}
+	}
+	table := func(name string) *yamlTable {
+		if y.Tables[name] == nil {
+			y.Tables[name] = &yamlTable{}
+		}
+		return y.Tables[name]
+	}
+	for name, filter := range c.filterMap {
+		table(name).Filter = filter
+	}
+	for name, where := range c.whereMap {
+		table(name).Where = where
+	}
+	for name, columns := range c.selectMap {
+		table(name).Columns = columns
+	}
+	for name, sample := range c.sampleMap {
+		table(name).Sample = sample
+	}
+	for name, rows := range c.insertRowsMap {
+		table(name).ExtendedInsertRows = rows
+	}
+	return y
+}
+
+// writeYAML writes the parsed config to w in the YAML format
+func (c *config) writeYAML(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.toYAML()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
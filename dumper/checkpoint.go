@@ -0,0 +1,206 @@
+package dumper
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Checkpoint records how far a dump went, so an interrupted dump can be
+// resumed instead of restarted from scratch.
+type Checkpoint struct {
+	Path       string   `json:"-"`
+	ConfigHash string   `json:"config_hash"`
+	SchemaHash string   `json:"schema_hash"`
+	Completed  []string `json:"completed"`
+	Table      string   `json:"table,omitempty"`
+	LastKey    string   `json:"last_key,omitempty"`
+	Offset     int64    `json:"offset"`
+	Finished   bool     `json:"finished"`
+}
+
+// LoadCheckpoint reads a checkpoint previously saved at path
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %s", path, err)
+	}
+	cp.Path = path
+	return cp, nil
+}
+
+// Save writes the checkpoint atomically to its path
+func (c *Checkpoint) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.Path)
+}
+
+// IsCompleted tells if table was completely dumped
+func (c *Checkpoint) IsCompleted(table string) bool {
+	for _, t := range c.Completed {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checkpoint) advance(table, lastKey string, offset int64) error {
+	c.Table, c.LastKey, c.Offset = table, lastKey, offset
+	return c.Save()
+}
+
+func (c *Checkpoint) complete(table string, offset int64) error {
+	c.Completed = append(c.Completed, table)
+	c.Table, c.LastKey, c.Offset = "", "", offset
+	return c.Save()
+}
+
+func (c *Checkpoint) finish(offset int64) error {
+	c.Table, c.LastKey, c.Offset, c.Finished = "", "", offset, true
+	return c.Save()
+}
+
+// GetSchemaHash returns a fingerprint of the columns of every table in the database
+func (d *mySQL) GetSchemaHash(ctx context.Context) (string, error) {
+	rows, err := d.DB.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE "+
+		"FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() "+
+		"ORDER BY TABLE_NAME, ORDINAL_POSITION")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	hash := sha256.New()
+	for rows.Next() {
+		var table, column, columnType string
+		if err = rows.Scan(&table, &column, &columnType); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s.%s %s\n", table, column, columnType)
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// OpenCheckpoint prepares the checkpoint saved at path. When resuming, the
+// checkpoint is loaded and refused if the config or the schema changed since
+// it was written. Otherwise a fresh checkpoint is created.
+func (d *mySQL) OpenCheckpoint(ctx context.Context, path, configHash string, resume bool) (*Checkpoint, error) {
+	schemaHash, err := d.GetSchemaHash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !resume {
+		cp := &Checkpoint{Path: path, ConfigHash: configHash, SchemaHash: schemaHash}
+		return cp, cp.Save()
+	}
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cp.Finished:
+		return nil, errors.New("Nothing to resume, the dump in checkpoint " + path + " has finished")
+	case cp.ConfigHash != configHash:
+		return nil, errors.New("Refusing to resume, the config file changed since checkpoint " + path)
+	case cp.SchemaHash != schemaHash:
+		return nil, errors.New("Refusing to resume, the database schema changed since checkpoint " + path)
+	}
+	return cp, nil
+}
+
+// chunkKey is the single column primary key used to dump a table in chunks
+type chunkKey struct {
+	Name string
+	// Cast is SIGNED or UNSIGNED for integer keys, so the key given as string
+	// is compared as an integer and not as a DOUBLE, which loses precision
+	// above 2^53
+	Cast string
+}
+
+// after returns the condition for the rows after value, a placeholder or a
+// quoted literal
+func (k chunkKey) after(value string) string {
+	if k.Cast != "" {
+		value = fmt.Sprintf("CAST(%s AS %s)", value, k.Cast)
+	}
+	return fmt.Sprintf("`%s` > %s", k.Name, value)
+}
+
+// integerTypes are the MySQL integer types
+var integerTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true, "bigint": true,
+}
+
+// Get the single column primary key used to dump the table in chunks. An
+// empty key means the table can't be chunked.
+func (d *mySQL) GetChunkKey(ctx context.Context, table string) (key chunkKey, err error) {
+	// A sampled table is dumped by a single query, with its LIMIT
+	if d.SampleMap[strings.ToLower(table)] > 0 {
+		return
+	}
+	var rows *sql.Rows
+	if rows, err = d.DB.QueryContext(ctx, "SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE "+
+		"FROM information_schema.KEY_COLUMN_USAGE JOIN information_schema.COLUMNS "+
+		"USING (TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME) "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'", table); err != nil {
+		return
+	}
+	defer rows.Close()
+	var keys []chunkKey
+	for rows.Next() {
+		var column chunkKey
+		var dataType, columnType string
+		if err = rows.Scan(&column.Name, &dataType, &columnType); err != nil {
+			return
+		}
+		if integerTypes[dataType] {
+			column.Cast = "SIGNED"
+			if strings.Contains(columnType, "unsigned") {
+				column.Cast = "UNSIGNED"
+			}
+		}
+		keys = append(keys, column)
+	}
+	if err = rows.Err(); err != nil || len(keys) != 1 {
+		return
+	}
+	// A replaced key no longer tells where the chunk stopped
+	if _, ok := d.SelectMap[strings.ToLower(table)][strings.ToLower(keys[0].Name)]; ok {
+		return
+	}
+	return keys[0], nil
+}
+
+// countingWriter keeps track of the output offset saved in checkpoints
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
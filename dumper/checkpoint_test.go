@@ -0,0 +1,163 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func tempCheckpointPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "dump.checkpoint")
+}
+
+func expectSchemaHash(mock sqlmock.Sqlmock, columnType string) {
+	mock.ExpectQuery("SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "COLUMN_TYPE"}).
+			AddRow("table", "id", columnType))
+}
+
+func TestCheckpointSaveAndLoad(t *testing.T) {
+	path := tempCheckpointPath(t)
+	cp := &Checkpoint{Path: path, ConfigHash: "c", SchemaHash: "s"}
+	assert.Nil(t, cp.complete("table1", 10))
+	assert.Nil(t, cp.advance("table2", "42", 20))
+
+	loaded, err := LoadCheckpoint(path)
+	assert.Nil(t, err)
+	assert.Equal(t, cp, loaded)
+	assert.True(t, loaded.IsCompleted("table1"))
+	assert.False(t, loaded.IsCompleted("table2"))
+}
+
+func TestMySQLOpenCheckpointRefusesChangedSchema(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	path := tempCheckpointPath(t)
+
+	expectSchemaHash(mock, "int")
+	_, err := dumper.OpenCheckpoint(context.Background(), path, "config", false)
+	assert.Nil(t, err)
+
+	expectSchemaHash(mock, "int")
+	_, err = dumper.OpenCheckpoint(context.Background(), path, "changed", true)
+	assert.Contains(t, err.Error(), "config file changed")
+
+	expectSchemaHash(mock, "bigint")
+	_, err = dumper.OpenCheckpoint(context.Background(), path, "config", true)
+	assert.Contains(t, err.Error(), "schema changed")
+
+	expectSchemaHash(mock, "int")
+	cp, err := dumper.OpenCheckpoint(context.Background(), path, "config", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "config", cp.ConfigHash)
+}
+
+func TestMySQLDumpTableDataInChunks(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ChunkSize = 2
+	dumper.WhereMap = map[string]string{"table": "id < 10 OR id > 20"}
+
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("table").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).AddRow("id", "int", "int(11)"))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "language"}).AddRow(1, "Go"))
+	mock.ExpectQuery("SELECT `id`, `language` FROM `table` WHERE \\(id < 10 OR id > 20\\) ORDER BY `id` LIMIT 2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "language"}).AddRow(1, "Go").AddRow(2, "C"))
+	mock.ExpectQuery("SELECT `id`, `language` FROM `table` WHERE \\(id < 10 OR id > 20\\) AND `id` > CAST\\(\\? AS SIGNED\\) ORDER BY `id` LIMIT 2").
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "language"}).AddRow(3, "Rust"))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 2, strings.Count(buffer.String(), "INSERT INTO `table` VALUES"))
+	assert.Contains(t, buffer.String(), `'Rust'`)
+}
+
+func TestMySQLDumpTableDataInChunksWithKeysAbove2To53(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ChunkSize = 2
+
+	// As a DOUBLE, 9007199254740993 would be 9007199254740992, so the key is
+	// compared as an integer
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("table").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("id", "bigint", "bigint(20) unsigned"))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table` ORDER BY `id` LIMIT 2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9007199254740992").AddRow("9007199254740993"))
+	mock.ExpectQuery("SELECT `id` FROM `table` WHERE `id` > CAST\\(\\? AS UNSIGNED\\) ORDER BY `id` LIMIT 2").
+		WithArgs("9007199254740993").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("9007199254740994"))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Contains(t, buffer.String(), "( '9007199254740993' )")
+	assert.Contains(t, buffer.String(), "( '9007199254740994' )")
+
+	buffer.Reset()
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("table").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("id", "bigint", "bigint(20) unsigned"))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table` WHERE `id` > CAST\\(\\? AS UNSIGNED\\) ORDER BY `id` LIMIT 2").
+		WithArgs("9007199254740993").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	assert.Nil(t, dumper.resumeTableData(context.Background(), buffer, "table", "9007199254740993"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Contains(t, buffer.String(), "DELETE FROM `table` WHERE `id` > CAST('9007199254740993' AS UNSIGNED);")
+}
+
+func TestMySQLDumpResumesFromCheckpoint(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ChunkSize = 10
+	dumper.Checkpoint = &Checkpoint{
+		Path:      tempCheckpointPath(t),
+		Completed: []string{"table1"},
+		Table:     "table2",
+		LastKey:   "7",
+		Offset:    100,
+	}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("table1", "BASE TABLE").
+			AddRow("table2", "BASE TABLE"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("table2").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).AddRow("id", "int", "int(11)"))
+	mock.ExpectQuery("SELECT \\* FROM `table2` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table2` WHERE `id` > CAST\\(\\? AS SIGNED\\) ORDER BY `id` LIMIT 10").
+		WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.NotContains(t, buffer.String(), "table1")
+	assert.NotContains(t, buffer.String(), "CREATE TABLE")
+	assert.Contains(t, buffer.String(), "DELETE FROM `table2` WHERE `id` > CAST('7' AS SIGNED);")
+	assert.Contains(t, buffer.String(), "INSERT INTO `table2` VALUES\n( '8' );")
+
+	loaded, err := LoadCheckpoint(dumper.Checkpoint.Path)
+	assert.Nil(t, err)
+	assert.True(t, loaded.Finished)
+	assert.Equal(t, []string{"table1", "table2"}, loaded.Completed)
+	assert.Equal(t, int64(100+buffer.Len()), loaded.Offset)
+}
@@ -0,0 +1,368 @@
+package dumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxPlaceholders is the most placeholders MySQL takes in a prepared statement
+const maxPlaceholders = 65535
+
+// CopyOptions tell how Copy writes into the target database
+type CopyOptions struct {
+	// Workers is the number of tables copied in parallel, one by default
+	Workers int
+	// LoadData loads the rows with LOAD DATA LOCAL INFILE, streamed from
+	// memory, instead of prepared INSERTs. The target needs local_infile on.
+	LoadData bool
+}
+
+// Copy copies the database into the target one, without any intermediate
+// file. Tables are dropped and created again in the target, and their data
+// is read with the same rules and masking as Dump, then written through
+// batched prepared INSERTs of ExtendedInsertRows rows, or LOAD DATA. Each
+// worker holds a connection to the target, with foreign key checks off.
+func (d *mySQL) Copy(ctx context.Context, target *sql.DB, options CopyOptions) (err error) {
+	// Workers notify the observers one at a time
+	observers := d.Observers
+	var mu sync.Mutex
+	d.Observers = make([]Observer, len(observers))
+	for i, o := range observers {
+		d.Observers[i] = &syncObserver{mu: &mu, o: o}
+	}
+	defer func() {
+		d.notify(func(o Observer) { o.DumpFinished(err) })
+		d.Observers = observers
+	}()
+
+	if err = d.enforcePolicy(ctx); err != nil {
+		return
+	}
+	d.Log.Debug("Getting table list", "phase", "tables")
+	tables, err := d.GetTablesContext(ctx)
+	if err != nil {
+		return
+	}
+	var pending []string
+	for _, table := range tables {
+		if d.filter(table) == "ignore" {
+			d.notify(func(o Observer) { o.TableSkipped(table, "ignore") })
+			continue
+		}
+		pending = append(pending, table)
+	}
+	if len(d.Observers) > 0 {
+		var estimates map[string]TableEstimate
+		if estimates, err = d.GetTableEstimates(ctx); err != nil {
+			return
+		}
+		estimatedRows := make(map[string]uint64)
+		for _, table := range pending {
+			if d.filter(table) != "nodata" {
+				estimatedRows[table] = estimates[table].Rows
+			}
+		}
+		d.notify(func(o Observer) { o.DumpStarted(estimatedRows) })
+	}
+	if options.LoadData {
+		if err = d.getCharset(ctx); err != nil {
+			return
+		}
+	}
+
+	// The first failing worker cancels the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+		for _, table := range pending {
+			select {
+			case queue <- table:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	workers := options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	var once sync.Once
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if workerErr := d.copyTables(ctx, target, queue, options); workerErr != nil {
+				once.Do(func() {
+					err = workerErr
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return
+}
+
+// copyTables copies the tables of the queue, until it's closed
+func (d *mySQL) copyTables(ctx context.Context, target *sql.DB, queue <-chan string, options CopyOptions) error {
+	dst, err := target.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if _, err = dst.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+		return err
+	}
+	// Table locks belong to the connection that took them, so each worker
+	// takes its own
+	var lock *sql.Conn
+	if d.UseTableLock {
+		if lock, err = d.DB.Conn(ctx); err != nil {
+			return err
+		}
+		defer lock.Close()
+	}
+	for table := range queue {
+		if err = d.copyTable(ctx, lock, dst, table, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *mySQL) copyTable(ctx context.Context, lock, dst *sql.Conn, table string, options CopyOptions) (err error) {
+	d.Log.Info("Copying structure", "table", table, "phase", "schema")
+	var tname, ddl string
+	if err = d.DB.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE `%s`", table)).Scan(&tname, &ddl); err != nil {
+		return
+	}
+	if _, err = dst.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS `%s`", table)); err != nil {
+		return
+	}
+	if _, err = dst.ExecContext(ctx, ddl); err != nil {
+		return
+	}
+	if d.filter(table) == "nodata" {
+		d.notify(func(o Observer) { o.TableSkipped(table, "nodata") })
+		return
+	}
+
+	if lock != nil {
+		// MySQL refuses to flush a table locked for reading, so flush first
+		if _, err = lock.ExecContext(ctx, fmt.Sprintf("FLUSH TABLES `%s`", table)); err != nil {
+			return
+		}
+		if _, err = lock.ExecContext(ctx, fmt.Sprintf("LOCK TABLES `%s` READ", table)); err != nil {
+			return
+		}
+		locked := time.Now()
+		defer func() {
+			if _, unlockErr := lock.ExecContext(context.Background(), "UNLOCK TABLES"); err == nil {
+				err = unlockErr
+			}
+			held := time.Since(locked)
+			d.notifyQuery(func(o QueryObserver) { o.LockReleased(table, held) })
+		}()
+	}
+	count, err := d.GetRowCountContext(ctx, table)
+	if err != nil {
+		return
+	}
+	return d.observeTable(table, count, func() error {
+		return d.logTableData(table, func() (int, error) {
+			return d.copyTableData(ctx, dst, table, options)
+		})
+	})
+}
+
+// copyTableData copies the rows of the table, returning how many were copied
+func (d *mySQL) copyTableData(ctx context.Context, dst *sql.Conn, table string, options CopyOptions) (int, error) {
+	rows, columns, err := d.selectAllDataFor(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if options.LoadData {
+		return d.loadDataInto(ctx, dst, table, rows, columns)
+	}
+	return d.insertInto(ctx, dst, table, rows, columns)
+}
+
+// insertQuery returns the INSERT statement of n rows of the columns
+func insertQuery(table string, columns []string, n int) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = fmt.Sprintf("`%s`", column)
+	}
+	row := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+	return fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s", table, strings.Join(names, ", "),
+		strings.TrimSuffix(strings.Repeat(row+",", n), ","))
+}
+
+// insertInto writes the rows with a prepared INSERT of ExtendedInsertRows
+// rows, or less to stay under the placeholder limit. The last batch, if
+// smaller, gets its own statement.
+func (d *mySQL) insertInto(ctx context.Context, dst *sql.Conn, table string, rows *sql.Rows, columns []string) (count int, err error) {
+	rowsPerInsert := d.ExtendedInsertRows
+	if n := d.InsertRowsMap[strings.ToLower(table)]; n > 0 {
+		rowsPerInsert = n
+	}
+	if max := maxPlaceholders / len(columns); rowsPerInsert > max {
+		rowsPerInsert = max
+	}
+
+	values := make([]*sql.RawBytes, len(columns))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	args := make([]interface{}, 0, rowsPerInsert*len(columns))
+	var batch, size int
+	var stmt *sql.Stmt
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+	flush := func() (err error) {
+		if batch == rowsPerInsert {
+			if stmt == nil {
+				if stmt, err = dst.PrepareContext(ctx, insertQuery(table, columns, batch)); err != nil {
+					return
+				}
+			}
+			_, err = stmt.ExecContext(ctx, args...)
+		} else {
+			_, err = dst.ExecContext(ctx, insertQuery(table, columns, batch), args...)
+		}
+		if err == nil {
+			d.notify(func(o Observer) { o.RowsDumped(table, uint64(batch), uint64(size)) })
+		}
+		args, batch, size = args[:0], 0, 0
+		return
+	}
+	for rows.Next() {
+		if err = rows.Scan(scanArgs...); err != nil {
+			return
+		}
+		// RawBytes are only valid until the next Scan, so they are copied
+		for _, value := range values {
+			if value == nil {
+				args = append(args, nil)
+				continue
+			}
+			args = append(args, append([]byte{}, *value...))
+			size += len(*value)
+		}
+		count++
+		if batch++; batch >= rowsPerInsert {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if batch > 0 {
+		err = flush()
+	}
+	return
+}
+
+// loadDataInto streams the rows to a LOAD DATA LOCAL INFILE statement through
+// a pipe, registered as a reader of the MySQL driver
+func (d *mySQL) loadDataInto(ctx context.Context, dst *sql.Conn, table string, rows *sql.Rows, columns []string) (count int, err error) {
+	pr, pw := io.Pipe()
+	name := "mysqlsuperdump/" + table
+	mysql.RegisterReaderHandler(name, func() io.Reader { return pr })
+	defer mysql.DeregisterReaderHandler(name)
+
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		count, err = d.writeRows(pw, table, rows, columns, NewLoadData().NewRowWriter)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	loadColumns := make([]Column, len(columns))
+	for i, column := range columns {
+		loadColumns[i] = Column{Name: column}
+	}
+	query := NewLoadData().LoadStatement("Reader::"+name, table, d.charset, loadColumns)
+	_, err = dst.ExecContext(ctx, strings.TrimSuffix(query, ";"))
+	// Unblocks the writer, if the statement failed before reading all rows
+	pr.Close()
+	if writeErr := <-written; writeErr != nil && err == nil {
+		err = writeErr
+	}
+	return
+}
+
+// syncObserver serializes the notifications of the workers of Copy
+type syncObserver struct {
+	mu *sync.Mutex
+	o  Observer
+}
+
+func (s *syncObserver) DumpStarted(estimatedRows map[string]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.o.DumpStarted(estimatedRows)
+}
+
+func (s *syncObserver) TableSkipped(table, filter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.o.TableSkipped(table, filter)
+}
+
+func (s *syncObserver) TableStarted(table string, rows uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.o.TableStarted(table, rows)
+}
+
+func (s *syncObserver) RowsDumped(table string, rows, bytes uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.o.RowsDumped(table, rows, bytes)
+}
+
+func (s *syncObserver) TableFinished(table string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.o.TableFinished(table, err)
+}
+
+func (s *syncObserver) DumpFinished(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.o.DumpFinished(err)
+}
+
+func (s *syncObserver) QueryDone(kind string, duration time.Duration, err error) {
+	if qo, ok := s.o.(QueryObserver); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		qo.QueryDone(kind, duration, err)
+	}
+}
+
+func (s *syncObserver) LockReleased(table string, held time.Duration) {
+	if qo, ok := s.o.(QueryObserver); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		qo.LockReleased(table, held)
+	}
+}
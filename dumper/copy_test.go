@@ -0,0 +1,160 @@
+package dumper
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertQuery(t *testing.T) {
+	assert.Equal(t, "INSERT INTO `people` (`id`, `name`) VALUES (?,?),(?,?)",
+		insertQuery("people", []string{"id", "name"}, 2))
+}
+
+func TestMySQLCopy(t *testing.T) {
+	db, mock := getDB(t)
+	target, targetMock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ExtendedInsertRows = 2
+	dumper.SelectMap = map[string]map[string]string{"people": {"name": "'masked'"}}
+	dumper.FilterMap = map[string]string{"logs": "nodata", "secrets": "ignore"}
+	observer := &recordingObserver{}
+	dumper.Observers = []Observer{observer}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("people", "BASE TABLE").
+			AddRow("logs", "BASE TABLE").
+			AddRow("secrets", "BASE TABLE"))
+	mock.ExpectQuery("information_schema.TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH"}).AddRow("people", 3, 100))
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectQuery("SHOW CREATE TABLE `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("people", "CREATE TABLE `people` (`id` int)"))
+	targetMock.ExpectExec("DROP TABLE IF EXISTS `people`").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `people` (`id` int)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM `people`")).WillReturnRows(
+		sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery("SELECT (.+) LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`, 'masked' AS `name` FROM `people`")).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(1, "masked").
+			AddRow(2, nil).
+			AddRow(3, "masked"))
+	targetMock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO `people` (`id`, `name`) VALUES (?,?),(?,?)")).
+		ExpectExec().WithArgs([]byte("1"), []byte("masked"), []byte("2"), nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	targetMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `people` (`id`, `name`) VALUES (?,?)")).
+		WithArgs([]byte("3"), []byte("masked")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery("SHOW CREATE TABLE `logs`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("logs", "CREATE TABLE `logs` (`line` text)"))
+	targetMock.ExpectExec("DROP TABLE IF EXISTS `logs`").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `logs` (`line` text)")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, dumper.Copy(context.Background(), target, CopyOptions{}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, targetMock.ExpectationsWereMet())
+	assert.Equal(t, []string{
+		"table secrets skipped ignore",
+		"dump started map[people:3]",
+		"query row_count <nil>",
+		"table people started 3",
+		"query select_data <nil>",
+		"table people rows 2",
+		"table people rows 1",
+		"table people finished <nil>",
+		"table logs skipped nodata",
+		"dump finished <nil>",
+	}, observer.events)
+	assert.Equal(t, []Observer{observer}, dumper.Observers)
+}
+
+func TestMySQLCopyReportsTablesOfParallelWorkers(t *testing.T) {
+	db, mock := getDB(t)
+	target, targetMock := getDB(t)
+	mock.MatchExpectationsInOrder(false)
+	targetMock.MatchExpectationsInOrder(false)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ExtendedInsertRows = 10
+
+	mock.ExpectQuery("SELECT VERSION\\(\\)").WillReturnRows(
+		sqlmock.NewRows([]string{"VERSION()"}).AddRow("8.0.36"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("people", "BASE TABLE").
+			AddRow("pets", "BASE TABLE"))
+	mock.ExpectQuery("information_schema.TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH"}))
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, table := range []string{"people", "pets"} {
+		mock.ExpectQuery("SHOW CREATE TABLE `" + table + "`").WillReturnRows(
+			sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow(table, "CREATE TABLE `"+table+"` (`id` int)"))
+		targetMock.ExpectExec("DROP TABLE IF EXISTS `" + table + "`").WillReturnResult(sqlmock.NewResult(0, 0))
+		targetMock.ExpectExec(regexp.QuoteMeta("CREATE TABLE `" + table + "`")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `" + table + "` LIMIT 1")).WillReturnRows(
+			sqlmock.NewRows([]string{"id"}))
+	}
+	// people is still being read while pets is copied
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM `people`")).WillReturnRows(
+		sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `people`")).WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+	targetMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `people` (`id`) VALUES (?),(?),(?)")).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM `pets`")).WillReturnRows(
+		sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `pets`")).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(10))
+	targetMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `pets` (`id`) VALUES (?)")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	report, err := dumper.NewReport(context.Background())
+	assert.Nil(t, err)
+	dumper.Observers = []Observer{report}
+	assert.Nil(t, dumper.Copy(context.Background(), target, CopyOptions{Workers: 2}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, targetMock.ExpectationsWereMet())
+
+	tables := make(map[string]*TableReport)
+	for _, table := range report.Tables {
+		tables[table.Name] = table
+	}
+	assert.Len(t, tables, 2)
+	assert.Equal(t, uint64(3), tables["people"].RowsExpected)
+	assert.Equal(t, uint64(3), tables["people"].RowsWritten)
+	assert.True(t, tables["people"].DurationSeconds >= 0.05)
+	assert.Equal(t, uint64(1), tables["pets"].RowsExpected)
+	assert.Equal(t, uint64(1), tables["pets"].RowsWritten)
+	assert.True(t, tables["pets"].DurationSeconds < 0.05)
+}
+
+func TestMySQLCopyHandlingErrorWhenCreatingTable(t *testing.T) {
+	db, mock := getDB(t)
+	target, targetMock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	expectedErr := errors.New("broken")
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("people", "BASE TABLE").
+			AddRow("pets", "BASE TABLE"))
+	targetMock.ExpectExec("SET FOREIGN_KEY_CHECKS = 0").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SHOW CREATE TABLE `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("people", "CREATE TABLE `people` (`id` int)"))
+	targetMock.ExpectExec("DROP TABLE IF EXISTS `people`").WillReturnResult(sqlmock.NewResult(0, 0))
+	targetMock.ExpectExec("CREATE TABLE").WillReturnError(expectedErr)
+
+	err := dumper.Copy(context.Background(), target, CopyOptions{})
+	assert.Equal(t, expectedErr, err)
+	// The next table isn't copied
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
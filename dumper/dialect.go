@@ -0,0 +1,60 @@
+package dumper
+
+import (
+	"context"
+	"io"
+)
+
+// Dialect writes the dump for another target than MySQL, in place of the SQL
+// statements of MySQL. The data of each table is written in a single query,
+// with the RowWriter of the dialect.
+type Dialect interface {
+	// Begin and End wrap the dump. When it fails, Aborted is called instead
+	// of End.
+	Begin(w io.Writer, database string)
+	End(w io.Writer)
+	Aborted(w io.Writer, err error)
+	// CreateTable writes the schema of a table
+	CreateTable(w io.Writer, table *TableSchema)
+	// BeginData and EndData wrap the rows of a table
+	BeginData(w io.Writer, table *TableSchema, rows uint64)
+	NewRowWriter(w io.Writer, table *TableSchema, columns []Column) (RowWriter, error)
+	EndData(w io.Writer, table *TableSchema)
+}
+
+// GetDatabase returns the name of the database dumped
+func (d *mySQL) GetDatabase(ctx context.Context) (database string, err error) {
+	err = d.DB.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&database)
+	return
+}
+
+// Dump a table with the Dialect
+func (d *mySQL) dumpTableDialect(ctx context.Context, w io.Writer, table string, skipData bool) (err error) {
+	d.Log.Info("Dumping structure", "table", table, "phase", "schema")
+	schema, err := d.GetTableSchema(ctx, table)
+	if err != nil {
+		return
+	}
+	d.Dialect.CreateTable(w, schema)
+	if skipData {
+		d.notify(func(o Observer) { o.TableSkipped(table, "nodata") })
+		return
+	}
+	count, err := d.GetRowCountContext(ctx, table)
+	if err != nil {
+		return
+	}
+	return d.observeTable(table, count, func() error {
+		d.Dialect.BeginData(w, schema, count)
+		err := d.logTableData(table, func() (int, error) {
+			return d.dumpTableRows(ctx, w, table, func(w io.Writer, columns []Column) (RowWriter, error) {
+				return d.Dialect.NewRowWriter(w, schema, columns)
+			})
+		})
+		if err != nil {
+			return err
+		}
+		d.Dialect.EndData(w, schema)
+		return nil
+	})
+}
@@ -0,0 +1,340 @@
+package dumper
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PostgreSQL writes the dump as a script for psql, with the data in COPY
+// blocks. AUTO_INCREMENT columns become identity columns, ENUM columns get
+// their own type named table_column, and keys become indexes named
+// table_key. TIME columns become intervals, as MySQL times hold durations
+// beyond a day and negative ones, and FULLTEXT keys become GIN indexes on the
+// text search vector of their columns. Foreign keys are added at the end,
+// once all tables exist, as NOT VALID, since filtered rows may break them,
+// like MySQL loads dumps with foreign key checks off. Foreign keys to tables
+// not dumped are dropped. The data must be UTF-8. Zero dates, invalid in
+// PostgreSQL, are written as NULL, and NUL bytes are dropped from text.
+type PostgreSQL struct {
+	// tables are the tables created so far, with their foreign keys
+	tables []*TableSchema
+}
+
+// NewPostgreSQL returns the PostgreSQL dialect
+func NewPostgreSQL() *PostgreSQL {
+	return &PostgreSQL{}
+}
+
+// pgString quotes a string literal, with standard_conforming_strings on
+func pgString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// typeArgs returns the arguments of a COLUMN_TYPE, like 10,2 of
+// decimal(10,2) unsigned
+func typeArgs(columnType string) string {
+	start, end := strings.Index(columnType, "("), strings.LastIndex(columnType, ")")
+	if start < 0 || end < start {
+		return ""
+	}
+	return columnType[start+1 : end]
+}
+
+// withArgs appends the arguments of the COLUMN_TYPE to a type, if any
+func withArgs(pgType string, column Column) string {
+	if args := typeArgs(column.Type); args != "" {
+		return pgType + "(" + args + ")"
+	}
+	return pgType
+}
+
+// pgType maps a column to a PostgreSQL type. Unsigned integers get the next
+// larger type.
+func pgType(table string, column Column) string {
+	unsigned := strings.Contains(column.Type, "unsigned")
+	switch column.DataType {
+	case "tinyint", "year":
+		return "smallint"
+	case "smallint":
+		if unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case "mediumint":
+		return "integer"
+	case "int", "integer":
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case "bigint":
+		if unsigned && !strings.Contains(column.Extra, "auto_increment") {
+			return "numeric(20)"
+		}
+		return "bigint"
+	case "bit":
+		return "bigint"
+	case "decimal", "numeric":
+		return withArgs("numeric", column)
+	case "float":
+		return "real"
+	case "double", "real":
+		return "double precision"
+	case "char", "varchar":
+		return withArgs(column.DataType, column)
+	case "date":
+		return "date"
+	case "datetime", "timestamp":
+		return withArgs("timestamp", column)
+	case "time":
+		return withArgs("interval", column)
+	case "json":
+		return "jsonb"
+	case "enum":
+		return quoteName(table + "_" + column.Name)
+	}
+	if binaryTypes[column.DataType] || spatialTypes[column.DataType] {
+		return "bytea"
+	}
+	return "text"
+}
+
+// tsVector returns the text search vector of the columns of a FULLTEXT key,
+// with the simple configuration, which like MySQL doesn't stem words
+func tsVector(columns []string) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = "coalesce(" + quoteName(column) + ", '')"
+	}
+	return "to_tsvector('simple', " + strings.Join(parts, " || ' ' || ") + ")"
+}
+
+// isZeroDate reports whether a value is a zero date of MySQL, like 0000-00-00
+func isZeroDate(value string) bool {
+	return strings.HasPrefix(value, "0000-00-00")
+}
+
+// pgDefault returns the DEFAULT clause of a column. Expressions other than
+// CURRENT_TIMESTAMP, and zero dates, are dropped.
+func pgDefault(column Column) string {
+	if !column.Default.Valid || isZeroDate(column.Default.String) {
+		return ""
+	}
+	value := column.Default.String
+	if strings.HasPrefix(strings.ToLower(value), "current_timestamp") {
+		return " DEFAULT CURRENT_TIMESTAMP"
+	}
+	if strings.Contains(column.Extra, "DEFAULT_GENERATED") {
+		return ""
+	}
+	if column.DataType == "bit" && strings.HasPrefix(value, "b'") {
+		if v, err := strconv.ParseUint(strings.Trim(value[1:], "'"), 2, 64); err == nil {
+			return fmt.Sprintf(" DEFAULT %d", v)
+		}
+	}
+	if jsonKindOf(column.DataType) == jsonNumber {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return " DEFAULT " + value
+		}
+	}
+	return " DEFAULT " + pgString(value)
+}
+
+// identityColumn returns the AUTO_INCREMENT column of the table, if any
+func identityColumn(table *TableSchema) string {
+	for _, column := range table.Columns {
+		if strings.Contains(column.Extra, "auto_increment") {
+			return column.Name
+		}
+	}
+	return ""
+}
+
+// Begin starts a transaction, so an aborted dump loads nothing
+func (p *PostgreSQL) Begin(w io.Writer, database string) {
+	fmt.Fprintf(w, "-- PostgreSQL dump of database %s\n", quoteName(database))
+	fmt.Fprintf(w, "SET client_encoding = 'UTF8';\n")
+	fmt.Fprintf(w, "SET standard_conforming_strings = on;\n")
+	fmt.Fprintf(w, "BEGIN;\n")
+}
+
+// End adds the foreign keys and commits the transaction
+func (p *PostgreSQL) End(w io.Writer) {
+	created := make(map[string]bool)
+	var foreignKeys bool
+	for _, table := range p.tables {
+		created[table.Name] = true
+		foreignKeys = foreignKeys || len(table.ForeignKeys) > 0
+	}
+	if foreignKeys {
+		fmt.Fprintf(w, "\n--\n-- Foreign keys\n--\n\n")
+	}
+	for _, table := range p.tables {
+		for _, key := range table.ForeignKeys {
+			if !created[key.ReferencedTable] {
+				fmt.Fprintf(w, "-- Foreign key %s of table %s dropped, as table %s isn't dumped\n",
+					quoteName(key.Name), quoteName(table.Name), quoteName(key.ReferencedTable))
+				continue
+			}
+			fmt.Fprintf(w, "ALTER TABLE %s ADD %s NOT VALID;\n", quoteName(table.Name), foreignKeyClause(key))
+		}
+	}
+	fmt.Fprintf(w, "COMMIT;\n")
+}
+
+// Aborted rolls the transaction back
+func (p *PostgreSQL) Aborted(w io.Writer, err error) {
+	fmt.Fprintf(w, "\n-- Dump aborted: %s\n", err)
+	fmt.Fprintf(w, "ROLLBACK;\n")
+}
+
+// CreateTable writes the CREATE TYPE, CREATE TABLE, CREATE INDEX and COMMENT
+// statements of the table
+func (p *PostgreSQL) CreateTable(w io.Writer, table *TableSchema) {
+	p.tables = append(p.tables, table)
+	name := quoteName(table.Name)
+	fmt.Fprintf(w, "\n--\n-- Structure for table %s\n--\n\n", name)
+	fmt.Fprintf(w, "DROP TABLE IF EXISTS %s CASCADE;\n", name)
+	for _, column := range table.Columns {
+		if column.DataType == "enum" {
+			enum := pgType(table.Name, column)
+			fmt.Fprintf(w, "DROP TYPE IF EXISTS %s;\n", enum)
+			fmt.Fprintf(w, "CREATE TYPE %s AS ENUM (%s);\n", enum, typeArgs(column.Type))
+		}
+	}
+
+	var lines []string
+	for _, column := range table.Columns {
+		line := quoteName(column.Name) + " " + pgType(table.Name, column)
+		if strings.Contains(column.Extra, "auto_increment") {
+			line += " GENERATED BY DEFAULT AS IDENTITY"
+		} else {
+			line += pgDefault(column)
+		}
+		if !column.Nullable {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	if len(table.Indexes) > 0 && table.Indexes[0].Name == "PRIMARY" {
+		lines = append(lines, "PRIMARY KEY ("+quoteNames(table.Indexes[0].Columns)+")")
+	}
+	fmt.Fprintf(w, "CREATE TABLE %s (\n  %s\n);\n", name, strings.Join(lines, ",\n  "))
+
+	for _, index := range table.Indexes {
+		if index.Name == "PRIMARY" {
+			continue
+		}
+		if index.Type == "FULLTEXT" {
+			fmt.Fprintf(w, "CREATE INDEX %s ON %s USING gin (%s);\n", quoteName(table.Name+"_"+index.Name),
+				name, tsVector(index.Columns))
+			continue
+		}
+		unique := ""
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+		fmt.Fprintf(w, "CREATE %sINDEX %s ON %s (%s);\n", unique, quoteName(table.Name+"_"+index.Name),
+			name, quoteNames(index.Columns))
+	}
+	if table.Comment != "" {
+		fmt.Fprintf(w, "COMMENT ON TABLE %s IS %s;\n", name, pgString(table.Comment))
+	}
+	for _, column := range table.Columns {
+		if column.Comment != "" {
+			fmt.Fprintf(w, "COMMENT ON COLUMN %s.%s IS %s;\n", name, quoteName(column.Name), pgString(column.Comment))
+		}
+	}
+}
+
+// BeginData writes the header of the rows
+func (p *PostgreSQL) BeginData(w io.Writer, table *TableSchema, rows uint64) {
+	fmt.Fprintf(w, "\n--\n-- Data for table %s -- %d rows\n--\n\n", quoteName(table.Name), rows)
+}
+
+// EndData moves the sequence of the identity column past the rows loaded
+func (p *PostgreSQL) EndData(w io.Writer, table *TableSchema) {
+	if column := identityColumn(table); column != "" {
+		fmt.Fprintf(w, "SELECT setval(pg_get_serial_sequence(%s, %s), COALESCE(MAX(%s), 0) + 1, false) FROM %s;\n",
+			pgString(quoteName(table.Name)), pgString(column), quoteName(column), quoteName(table.Name))
+	}
+}
+
+// NewRowWriter starts the COPY block of the rows, ended by Close
+func (p *PostgreSQL) NewRowWriter(w io.Writer, table *TableSchema, columns []Column) (RowWriter, error) {
+	pw := &pgWriter{w: bufio.NewWriter(w)}
+	for _, column := range columns {
+		pw.kinds = append(pw.kinds, jsonKindOf(column.DataType))
+		pw.bits = append(pw.bits, column.DataType == "bit")
+		pw.dates = append(pw.dates, column.DataType == "date" || column.DataType == "datetime" ||
+			column.DataType == "timestamp")
+	}
+	_, err := fmt.Fprintf(pw.w, "COPY %s (%s) FROM stdin;\n", quoteName(table.Name), quoteNames(columnNames(columns)))
+	return pw, err
+}
+
+type pgWriter struct {
+	w     *bufio.Writer
+	kinds []jsonKind
+	bits  []bool
+	dates []bool
+}
+
+// WriteRow writes a row in the text format of COPY: tab separated fields,
+// NULL as \N and backslash escapes
+func (pw *pgWriter) WriteRow(values []*sql.RawBytes) error {
+	for i, value := range values {
+		if i > 0 {
+			pw.w.WriteByte('\t')
+		}
+		switch {
+		case value == nil || pw.dates[i] && isZeroDate(string(*value)):
+			pw.w.WriteString(`\N`)
+		case pw.bits[i]:
+			pw.w.WriteString(strconv.FormatUint(bitValue(*value), 10))
+		case pw.kinds[i] == jsonBinary:
+			pw.w.WriteString(`\\x`)
+			pw.w.WriteString(hex.EncodeToString(*value))
+		default:
+			pw.writeText(*value)
+		}
+	}
+	_, err := pw.w.WriteString("\n")
+	return err
+}
+
+func (pw *pgWriter) writeText(value []byte) {
+	last := 0
+	for j, c := range value {
+		var esc string
+		switch c {
+		case '\\':
+			esc = `\\`
+		case '\t':
+			esc = `\t`
+		case '\n':
+			esc = `\n`
+		case '\r':
+			esc = `\r`
+		case 0:
+			// Text can't hold NUL bytes in PostgreSQL
+		default:
+			continue
+		}
+		pw.w.Write(value[last:j])
+		pw.w.WriteString(esc)
+		last = j + 1
+	}
+	pw.w.Write(value[last:])
+}
+
+// Close ends the COPY block
+func (pw *pgWriter) Close() error {
+	pw.w.WriteString("\\.\n")
+	return pw.w.Flush()
+}
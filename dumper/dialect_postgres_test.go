@@ -0,0 +1,148 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgreSQLCreateTable(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	NewPostgreSQL().CreateTable(buffer, &TableSchema{
+		Name:    "order",
+		Comment: "Customer's orders",
+		Columns: []Column{
+			{Name: "id", DataType: "int", Type: "int(10) unsigned", Extra: "auto_increment"},
+			{Name: "code", DataType: "varchar", Type: "varchar(20)", Default: sql.NullString{String: "it's", Valid: true}},
+			{Name: "price", DataType: "decimal", Type: "decimal(10,2)", Nullable: true,
+				Default: sql.NullString{String: "0.00", Valid: true}},
+			{Name: "status", DataType: "enum", Type: "enum('new','paid')", Default: sql.NullString{String: "new", Valid: true}},
+			{Name: "paid", DataType: "bit", Type: "bit(1)", Default: sql.NullString{String: "b'1'", Valid: true}},
+			{Name: "created", DataType: "datetime", Type: "datetime(3)", Extra: "DEFAULT_GENERATED",
+				Default: sql.NullString{String: "CURRENT_TIMESTAMP(3)", Valid: true}},
+			{Name: "shipped", DataType: "date", Type: "date", Default: sql.NullString{String: "0000-00-00", Valid: true}},
+			{Name: "photo", DataType: "mediumblob", Type: "mediumblob", Nullable: true, Comment: "JPEG"},
+			{Name: "wait", DataType: "time", Type: "time(3)", Nullable: true},
+			{Name: "notes", DataType: "text", Type: "text", Nullable: true},
+		},
+		Indexes: []Index{
+			{Name: "PRIMARY", Unique: true, Columns: []string{"id"}},
+			{Name: "code", Unique: true, Columns: []string{"code"}},
+			{Name: "status_created", Columns: []string{"status", "created"}},
+			{Name: "search", Type: "FULLTEXT", Columns: []string{"code", "notes"}},
+		},
+	})
+	assert.Equal(t, "\n--\n-- Structure for table \"order\"\n--\n\n"+
+		"DROP TABLE IF EXISTS \"order\" CASCADE;\n"+
+		"DROP TYPE IF EXISTS \"order_status\";\n"+
+		"CREATE TYPE \"order_status\" AS ENUM ('new','paid');\n"+
+		"CREATE TABLE \"order\" (\n"+
+		"  \"id\" bigint GENERATED BY DEFAULT AS IDENTITY NOT NULL,\n"+
+		"  \"code\" varchar(20) DEFAULT 'it''s' NOT NULL,\n"+
+		"  \"price\" numeric(10,2) DEFAULT 0.00,\n"+
+		"  \"status\" \"order_status\" DEFAULT 'new' NOT NULL,\n"+
+		"  \"paid\" bigint DEFAULT 1 NOT NULL,\n"+
+		"  \"created\" timestamp(3) DEFAULT CURRENT_TIMESTAMP NOT NULL,\n"+
+		"  \"shipped\" date NOT NULL,\n"+
+		"  \"photo\" bytea,\n"+
+		"  \"wait\" interval(3),\n"+
+		"  \"notes\" text,\n"+
+		"  PRIMARY KEY (\"id\")\n"+
+		");\n"+
+		"CREATE UNIQUE INDEX \"order_code\" ON \"order\" (\"code\");\n"+
+		"CREATE INDEX \"order_status_created\" ON \"order\" (\"status\", \"created\");\n"+
+		"CREATE INDEX \"order_search\" ON \"order\" "+
+		"USING gin (to_tsvector('simple', coalesce(\"code\", '') || ' ' || coalesce(\"notes\", '')));\n"+
+		"COMMENT ON TABLE \"order\" IS 'Customer''s orders';\n"+
+		"COMMENT ON COLUMN \"order\".\"photo\" IS 'JPEG';\n", buffer.String())
+}
+
+func TestPostgreSQLForeignKeys(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dialect := NewPostgreSQL()
+	dialect.CreateTable(ioutil.Discard, &TableSchema{
+		Name: "order",
+		ForeignKeys: []ForeignKey{
+			{Name: "order_customer", Columns: []string{"customer_id"}, ReferencedTable: "customer",
+				ReferencedColumns: []string{"id"}, OnDelete: "CASCADE", OnUpdate: "NO ACTION"},
+			{Name: "order_shop", Columns: []string{"shop_id"}, ReferencedTable: "shop",
+				ReferencedColumns: []string{"id"}, OnDelete: "RESTRICT", OnUpdate: "RESTRICT"},
+		},
+	})
+	dialect.CreateTable(ioutil.Discard, &TableSchema{Name: "customer"})
+	dialect.End(buffer)
+	assert.Equal(t, "\n--\n-- Foreign keys\n--\n\n"+
+		"ALTER TABLE \"order\" ADD CONSTRAINT \"order_customer\" FOREIGN KEY (\"customer_id\") "+
+		"REFERENCES \"customer\" (\"id\") ON DELETE CASCADE NOT VALID;\n"+
+		"-- Foreign key \"order_shop\" of table \"order\" dropped, as table \"shop\" isn't dumped\n"+
+		"COMMIT;\n", buffer.String())
+}
+
+func TestPostgreSQLRowWriter(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{
+		{Name: "id", DataType: "int"},
+		{Name: "note", DataType: "text"},
+		{Name: "photo", DataType: "blob"},
+		{Name: "flags", DataType: "bit"},
+		{Name: "shipped", DataType: "date"},
+	}
+	rw, err := NewPostgreSQL().NewRowWriter(buffer, &TableSchema{Name: "t"}, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "a\tb\r\nc\\d\x00e", "\x00\xff", "\x01\x02", "2024-01-02")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", nil, nil, nil, "0000-00-00")))
+	assert.Nil(t, rw.WriteRow(rawBytes("3", `\.`, "", "\x00", nil)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, "COPY \"t\" (\"id\", \"note\", \"photo\", \"flags\", \"shipped\") FROM stdin;\n"+
+		"1\ta\\tb\\r\\nc\\\\de\t\\\\x00ff\t258\t2024-01-02\n"+
+		"2\t\\N\t\\N\t\\N\t\\N\n"+
+		"3\t\\\\.\t\\\\x\t0\t\\N\n"+
+		"\\.\n", buffer.String())
+}
+
+func TestMySQLDumpWithPostgreSQL(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Dialect = NewPostgreSQL()
+	dumper.SelectMap = map[string]map[string]string{"people": {"name": "'masked'"}}
+
+	mock.ExpectQuery("SELECT DATABASE\\(\\)").WillReturnRows(
+		sqlmock.NewRows([]string{"DATABASE()"}).AddRow("shop"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("people", "BASE TABLE"))
+	expectTableSchema(mock, "people")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `people` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Ann"))
+	mock.ExpectQuery("SELECT `id`, 'masked' AS `name` FROM `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "masked"))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	dump := buffer.String()
+	assert.True(t, strings.HasPrefix(dump, "-- PostgreSQL dump of database \"shop\"\n"+
+		"SET client_encoding = 'UTF8';\nSET standard_conforming_strings = on;\nBEGIN;\n"))
+	assert.Contains(t, dump, "CREATE TABLE \"people\" (\n"+
+		"  \"id\" integer GENERATED BY DEFAULT AS IDENTITY NOT NULL,\n"+
+		"  \"name\" varchar(50) DEFAULT 'unknown',\n"+
+		"  PRIMARY KEY (\"id\")\n"+
+		");\n"+
+		"CREATE INDEX \"people_name_id\" ON \"people\" (\"name\", \"id\");\n"+
+		"COMMENT ON TABLE \"people\" IS 'People & pets';\n"+
+		"COMMENT ON COLUMN \"people\".\"name\" IS 'Full name';\n")
+	assert.Contains(t, dump, "-- Data for table \"people\" -- 1 rows\n--\n\n"+
+		"COPY \"people\" (\"id\", \"name\") FROM stdin;\n1\tmasked\n\\.\n"+
+		"SELECT setval(pg_get_serial_sequence('\"people\"', 'id'), COALESCE(MAX(\"id\"), 0) + 1, false) FROM \"people\";\n")
+	assert.True(t, strings.HasSuffix(dump, "\n--\n-- Foreign keys\n--\n\n"+
+		"-- Foreign key \"people_name\" of table \"people\" dropped, as table \"names\" isn't dumped\n"+
+		"COMMIT;\n"))
+}
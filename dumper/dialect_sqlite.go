@@ -0,0 +1,214 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SQLite writes the dump as a script for the sqlite3 shell, like
+// sqlite3 test.db < dump.sql. Columns get the type of their SQLite affinity,
+// AUTO_INCREMENT primary keys become INTEGER PRIMARY KEY, and keys become
+// indexes named after their table, as index names are global in SQLite.
+// Foreign keys are kept in CREATE TABLE, and only checked by SQLite once
+// PRAGMA foreign_keys is on. Engine, charset and comments are dropped.
+type SQLite struct{}
+
+// NewSQLite returns the SQLite dialect
+func NewSQLite() *SQLite {
+	return &SQLite{}
+}
+
+// sqliteString quotes a string literal. SQLite has no escapes in literals,
+// so strings with NUL bytes are cast from a blob.
+func sqliteString(s []byte) string {
+	if bytes.IndexByte(s, 0) >= 0 {
+		return "CAST(X'" + hex.EncodeToString(s) + "' AS TEXT)"
+	}
+	return "'" + strings.ReplaceAll(string(s), "'", "''") + "'"
+}
+
+// sqliteType maps the DATA_TYPE of information_schema to a SQLite type
+func sqliteType(dataType string) string {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		return "INTEGER"
+	case "float", "double", "real":
+		return "REAL"
+	case "decimal", "numeric":
+		return "NUMERIC"
+	}
+	if binaryTypes[dataType] || spatialTypes[dataType] {
+		return "BLOB"
+	}
+	return "TEXT"
+}
+
+// bitValue converts the big endian bytes of a BIT value to a number
+func bitValue(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// sqliteDefault returns the DEFAULT clause of a column. Expressions other
+// than CURRENT_TIMESTAMP have no equivalent and are dropped.
+func sqliteDefault(column Column) string {
+	if !column.Default.Valid {
+		return ""
+	}
+	value := column.Default.String
+	if strings.HasPrefix(strings.ToLower(value), "current_timestamp") {
+		return " DEFAULT CURRENT_TIMESTAMP"
+	}
+	if strings.Contains(column.Extra, "DEFAULT_GENERATED") {
+		return ""
+	}
+	switch sqliteType(column.DataType) {
+	case "INTEGER", "REAL", "NUMERIC":
+		if column.DataType == "bit" && strings.HasPrefix(value, "b'") {
+			if v, err := strconv.ParseUint(strings.Trim(value[1:], "'"), 2, 64); err == nil {
+				return fmt.Sprintf(" DEFAULT %d", v)
+			}
+		}
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return " DEFAULT " + value
+		}
+	}
+	return " DEFAULT " + sqliteString([]byte(value))
+}
+
+// Begin starts a transaction, so an aborted dump loads nothing
+func (s *SQLite) Begin(w io.Writer, database string) {
+	fmt.Fprintf(w, "-- SQLite dump of database %s\n", quoteName(database))
+	fmt.Fprintf(w, "PRAGMA foreign_keys = OFF;\n")
+	fmt.Fprintf(w, "BEGIN TRANSACTION;\n")
+}
+
+// End commits the transaction
+func (s *SQLite) End(w io.Writer) {
+	fmt.Fprintf(w, "COMMIT;\n")
+}
+
+// Aborted rolls the transaction back
+func (s *SQLite) Aborted(w io.Writer, err error) {
+	fmt.Fprintf(w, "\n-- Dump aborted: %s\n", err)
+	fmt.Fprintf(w, "ROLLBACK;\n")
+}
+
+// CreateTable writes the CREATE TABLE and CREATE INDEX statements of the table
+func (s *SQLite) CreateTable(w io.Writer, table *TableSchema) {
+	name := quoteName(table.Name)
+	fmt.Fprintf(w, "\n--\n-- Structure for table %s\n--\n\n", name)
+	fmt.Fprintf(w, "DROP TABLE IF EXISTS %s;\n", name)
+
+	// A single AUTO_INCREMENT integer column in the primary key becomes an
+	// alias of the rowid
+	var primary *Index
+	var rowid string
+	if len(table.Indexes) > 0 && table.Indexes[0].Name == "PRIMARY" {
+		primary = &table.Indexes[0]
+		if len(primary.Columns) == 1 {
+			for _, column := range table.Columns {
+				if column.Name == primary.Columns[0] && sqliteType(column.DataType) == "INTEGER" &&
+					strings.Contains(column.Extra, "auto_increment") {
+					rowid = column.Name
+				}
+			}
+		}
+	}
+
+	var lines []string
+	for _, column := range table.Columns {
+		if column.Name == rowid {
+			lines = append(lines, quoteName(column.Name)+" INTEGER PRIMARY KEY")
+			continue
+		}
+		line := quoteName(column.Name) + " " + sqliteType(column.DataType)
+		if !column.Nullable {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line+sqliteDefault(column))
+	}
+	if primary != nil && rowid == "" {
+		lines = append(lines, "PRIMARY KEY ("+quoteNames(primary.Columns)+")")
+	}
+	for _, key := range table.ForeignKeys {
+		lines = append(lines, foreignKeyClause(key))
+	}
+	fmt.Fprintf(w, "CREATE TABLE %s (\n  %s\n);\n", name, strings.Join(lines, ",\n  "))
+
+	for _, index := range table.Indexes {
+		if index.Name == "PRIMARY" {
+			continue
+		}
+		unique := ""
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+		fmt.Fprintf(w, "CREATE %sINDEX %s ON %s (%s);\n", unique, quoteName(table.Name+"_"+index.Name),
+			name, quoteNames(index.Columns))
+	}
+}
+
+// BeginData writes the header of the rows
+func (s *SQLite) BeginData(w io.Writer, table *TableSchema, rows uint64) {
+	fmt.Fprintf(w, "\n--\n-- Data for table %s -- %d rows\n--\n\n", quoteName(table.Name), rows)
+}
+
+// EndData writes nothing, as the rows are single statements
+func (s *SQLite) EndData(w io.Writer, table *TableSchema) {}
+
+// NewRowWriter returns the writer of INSERT statements, one per row, as the
+// sqlite3 shell writes them
+func (s *SQLite) NewRowWriter(w io.Writer, table *TableSchema, columns []Column) (RowWriter, error) {
+	sw := &sqliteWriter{w: bufio.NewWriter(w), insert: "INSERT INTO " + quoteName(table.Name) + " VALUES("}
+	for _, column := range columns {
+		sw.kinds = append(sw.kinds, jsonKindOf(column.DataType))
+		sw.bits = append(sw.bits, column.DataType == "bit")
+	}
+	return sw, nil
+}
+
+type sqliteWriter struct {
+	w      *bufio.Writer
+	insert string
+	kinds  []jsonKind
+	bits   []bool
+}
+
+func (sw *sqliteWriter) WriteRow(values []*sql.RawBytes) error {
+	sw.w.WriteString(sw.insert)
+	for i, value := range values {
+		if i > 0 {
+			sw.w.WriteByte(',')
+		}
+		switch {
+		case value == nil:
+			sw.w.WriteString("NULL")
+		case sw.bits[i]:
+			sw.w.WriteString(strconv.FormatUint(bitValue(*value), 10))
+		case sw.kinds[i] == jsonBinary:
+			sw.w.WriteString("X'")
+			sw.w.WriteString(hex.EncodeToString(*value))
+			sw.w.WriteByte('\'')
+		case sw.kinds[i] == jsonNumber && len(*value) > 0:
+			sw.w.Write(*value)
+		default:
+			sw.w.WriteString(sqliteString(*value))
+		}
+	}
+	_, err := sw.w.WriteString(");\n")
+	return err
+}
+
+func (sw *sqliteWriter) Close() error {
+	return sw.w.Flush()
+}
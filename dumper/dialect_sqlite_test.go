@@ -0,0 +1,121 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteCreateTable(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	NewSQLite().CreateTable(buffer, &TableSchema{
+		Name:   "order",
+		Engine: "InnoDB",
+		Columns: []Column{
+			{Name: "id", DataType: "bigint", Extra: "auto_increment"},
+			{Name: "code", DataType: "varchar", Default: sql.NullString{String: "it's", Valid: true}},
+			{Name: "price", DataType: "decimal", Nullable: true, Default: sql.NullString{String: "0.00", Valid: true}},
+			{Name: "paid", DataType: "bit", Default: sql.NullString{String: "b'1'", Valid: true}},
+			{Name: "created", DataType: "datetime", Extra: "DEFAULT_GENERATED",
+				Default: sql.NullString{String: "CURRENT_TIMESTAMP", Valid: true}},
+			{Name: "uuid", DataType: "binary", Extra: "DEFAULT_GENERATED",
+				Default: sql.NullString{String: "uuid_to_bin(uuid())", Valid: true}},
+		},
+		Indexes: []Index{
+			{Name: "PRIMARY", Unique: true, Columns: []string{"id"}},
+			{Name: "code", Unique: true, Columns: []string{"code"}},
+			{Name: "paid_created", Columns: []string{"paid", "created"}},
+		},
+	})
+	assert.Equal(t, "\n--\n-- Structure for table \"order\"\n--\n\n"+
+		"DROP TABLE IF EXISTS \"order\";\n"+
+		"CREATE TABLE \"order\" (\n"+
+		"  \"id\" INTEGER PRIMARY KEY,\n"+
+		"  \"code\" TEXT NOT NULL DEFAULT 'it''s',\n"+
+		"  \"price\" NUMERIC DEFAULT 0.00,\n"+
+		"  \"paid\" INTEGER NOT NULL DEFAULT 1,\n"+
+		"  \"created\" TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,\n"+
+		"  \"uuid\" BLOB NOT NULL\n"+
+		");\n"+
+		"CREATE UNIQUE INDEX \"order_code\" ON \"order\" (\"code\");\n"+
+		"CREATE INDEX \"order_paid_created\" ON \"order\" (\"paid\", \"created\");\n", buffer.String())
+}
+
+func TestSQLiteCreateTableWithCompositeKey(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	NewSQLite().CreateTable(buffer, &TableSchema{
+		Name:    "tag",
+		Columns: []Column{{Name: "item", DataType: "int"}, {Name: "name", DataType: "char"}},
+		Indexes: []Index{{Name: "PRIMARY", Unique: true, Columns: []string{"item", "name"}}},
+	})
+	assert.Contains(t, buffer.String(), "CREATE TABLE \"tag\" (\n"+
+		"  \"item\" INTEGER NOT NULL,\n"+
+		"  \"name\" TEXT NOT NULL,\n"+
+		"  PRIMARY KEY (\"item\", \"name\")\n"+
+		");\n")
+}
+
+func TestSQLiteRowWriter(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{
+		{Name: "id", DataType: "unsigned bigint"},
+		{Name: "note", DataType: "varchar"},
+		{Name: "photo", DataType: "blob"},
+		{Name: "flags", DataType: "bit"},
+	}
+	rw, err := NewSQLite().NewRowWriter(buffer, &TableSchema{Name: "t"}, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "it's a \\n\nline", "\x00\xff", "\x01\x02")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", "a\x00b", nil, nil)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, "INSERT INTO \"t\" VALUES(1,'it''s a \\n\nline',X'00ff',258);\n"+
+		"INSERT INTO \"t\" VALUES(2,CAST(X'610062' AS TEXT),NULL,NULL);\n", buffer.String())
+}
+
+func TestMySQLDumpWithSQLite(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Dialect = NewSQLite()
+
+	mock.ExpectQuery("SELECT DATABASE\\(\\)").WillReturnRows(
+		sqlmock.NewRows([]string{"DATABASE()"}).AddRow("shop"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("people", "BASE TABLE"))
+	expectTableSchema(mock, "people")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `people` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Ann"))
+	mock.ExpectQuery("SELECT `id`, `name` FROM `people`").WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			sqlmock.NewColumn("id").OfType("INT", 0),
+			sqlmock.NewColumn("name").OfType("VARCHAR", "")).AddRow(1, "Ann"))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	dump := buffer.String()
+	assert.True(t, strings.HasPrefix(dump, "-- SQLite dump of database \"shop\"\n"+
+		"PRAGMA foreign_keys = OFF;\nBEGIN TRANSACTION;\n"))
+	assert.Contains(t, dump, "CREATE TABLE \"people\" (\n"+
+		"  \"id\" INTEGER PRIMARY KEY,\n"+
+		"  \"name\" TEXT DEFAULT 'unknown',\n"+
+		"  CONSTRAINT \"people_name\" FOREIGN KEY (\"name\", \"id\") REFERENCES \"names\" (\"name\", \"person_id\") ON DELETE SET NULL\n"+
+		");\n"+
+		"CREATE INDEX \"people_name_id\" ON \"people\" (\"name\", \"id\");\n")
+	assert.Contains(t, dump, "-- Data for table \"people\" -- 1 rows\n--\n\nINSERT INTO \"people\" VALUES(1,'Ann');\n")
+	assert.True(t, strings.HasSuffix(dump, "COMMIT;\n"))
+}
+
+func TestSQLiteAborted(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	NewSQLite().Aborted(buffer, errors.New("Lost connection"))
+	assert.Equal(t, "\n-- Dump aborted: Lost connection\nROLLBACK;\n", buffer.String())
+}
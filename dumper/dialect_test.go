@@ -0,0 +1,68 @@
+package dumper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectTableSchema expects the queries of GetTableSchema for a table with an
+// id primary key and a nullable name with a default
+func expectTableSchema(mock sqlmock.Sqlmock, table string) {
+	mock.ExpectQuery("SELECT ENGINE, TABLE_COLLATION, TABLE_COMMENT FROM information_schema.TABLES").
+		WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"ENGINE", "TABLE_COLLATION", "TABLE_COMMENT"}).
+			AddRow("InnoDB", "utf8mb4_general_ci", "People & pets"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, COLUMN_KEY, EXTRA, " +
+		"COLUMN_COMMENT FROM information_schema.COLUMNS").
+		WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE", "IS_NULLABLE",
+			"COLUMN_DEFAULT", "COLUMN_KEY", "EXTRA", "COLUMN_COMMENT"}).
+			AddRow("id", "int", "int(11)", "NO", nil, "PRI", "auto_increment", "").
+			AddRow("name", "varchar", "varchar(50)", "YES", "unknown", "MUL", "", "Full name"))
+	mock.ExpectQuery("SELECT INDEX_NAME, NON_UNIQUE, INDEX_TYPE, COLUMN_NAME FROM information_schema.STATISTICS").
+		WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"INDEX_NAME", "NON_UNIQUE", "INDEX_TYPE", "COLUMN_NAME"}).
+			AddRow("PRIMARY", 0, "BTREE", "id").
+			AddRow("name_id", 1, "BTREE", "name").
+			AddRow("name_id", 1, "BTREE", "id").
+			AddRow("functional", 1, "BTREE", nil))
+	mock.ExpectQuery("SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, " +
+		"r.DELETE_RULE, r.UPDATE_RULE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs(table).
+		WillReturnRows(sqlmock.NewRows([]string{"CONSTRAINT_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME",
+			"REFERENCED_COLUMN_NAME", "DELETE_RULE", "UPDATE_RULE"}).
+			AddRow("people_name", "name", "names", "name", "SET NULL", "NO ACTION").
+			AddRow("people_name", "id", "names", "person_id", "SET NULL", "NO ACTION"))
+}
+
+func TestMySQLGetTableSchema(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	expectTableSchema(mock, "people")
+
+	schema, err := dumper.GetTableSchema(context.Background(), "people")
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "InnoDB", schema.Engine)
+	assert.Equal(t, 2, len(schema.Columns))
+	assert.False(t, schema.Columns[0].Nullable)
+	assert.False(t, schema.Columns[0].Default.Valid)
+	assert.Equal(t, "auto_increment", schema.Columns[0].Extra)
+	assert.True(t, schema.Columns[1].Nullable)
+	assert.Equal(t, "unknown", schema.Columns[1].Default.String)
+	assert.Equal(t, []Index{
+		{Name: "PRIMARY", Unique: true, Type: "BTREE", Columns: []string{"id"}},
+		{Name: "name_id", Unique: false, Type: "BTREE", Columns: []string{"name", "id"}},
+	}, schema.Indexes)
+	assert.Equal(t, []ForeignKey{{
+		Name:              "people_name",
+		Columns:           []string{"name", "id"},
+		ReferencedTable:   "names",
+		ReferencedColumns: []string{"name", "person_id"},
+		OnDelete:          "SET NULL",
+		OnUpdate:          "NO ACTION",
+	}}, schema.ForeignKeys)
+}
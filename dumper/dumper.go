@@ -0,0 +1,58 @@
+package dumper
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+)
+
+// Dumper dumps a database. NewMySQLDumper and NewPostgreSQLDumper return its
+// implementations, which apply the same Rules.
+type Dumper interface {
+	// GetTablesContext lists the base tables of the database
+	GetTablesContext(ctx context.Context) ([]string, error)
+	// DumpCreateTableContext writes the statements creating a table
+	DumpCreateTableContext(ctx context.Context, w io.Writer, table string) error
+	// DumpTableDataContext writes the data of a table, as selected by the
+	// Rules
+	DumpTableDataContext(ctx context.Context, w io.Writer, table string) error
+	// LockTableReadingContext keeps a table from changing while it's dumped,
+	// until UnlockTablesContext
+	LockTableReadingContext(ctx context.Context, table string) (sql.Result, error)
+	UnlockTablesContext(ctx context.Context) (sql.Result, error)
+	// Dump writes the whole database to w, with a consistent view of each
+	// table
+	Dump(ctx context.Context, w io.Writer) error
+}
+
+var (
+	_ Dumper = (*mySQL)(nil)
+	_ Dumper = (*pgSQL)(nil)
+)
+
+// Rules choose the tables, rows and columns dumped, and mask their values.
+// Keys are lower case table names, and column names for SelectMap.
+type Rules struct {
+	// SelectMap replaces columns by SQL expressions
+	SelectMap map[string]map[string]string
+	// WhereMap restricts the rows of tables
+	WhereMap map[string]string
+	// FilterMap ignores tables (ignore), or their data (nodata)
+	FilterMap map[string]string
+	// SampleMap dumps at most this many rows of tables
+	SampleMap map[string]int
+	// Tables and ExcludeTables are patterns of the tables dumped, or not
+	Tables        []string
+	ExcludeTables []string
+}
+
+// filter returns the filter of the table. Tables left out of Tables, when
+// given, or matching ExcludeTables are ignored.
+func (r *Rules) filter(table string) string {
+	key := strings.ToLower(table)
+	if (len(r.Tables) > 0 && !matchAny(r.Tables, key)) || matchAny(r.ExcludeTables, key) {
+		return "ignore"
+	}
+	return r.FilterMap[key]
+}
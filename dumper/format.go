@@ -0,0 +1,449 @@
+package dumper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format writes the data of each table to its own file, instead of INSERT
+// statements in the dump, which keeps the schema only
+type Format interface {
+	// Extension of the data files, like .csv
+	Extension() string
+	// NewRowWriter starts writing rows with the given columns to w
+	NewRowWriter(w io.Writer, columns []Column) (RowWriter, error)
+}
+
+// Loader is a Format whose data files MySQL can load. The statement loading
+// them is written to the dump, in place of the INSERT statements.
+type Loader interface {
+	LoadStatement(path, table, charset string, columns []Column) string
+}
+
+// RowWriter writes the rows of a table. Nil values are NULL.
+type RowWriter interface {
+	WriteRow(values []*sql.RawBytes) error
+	// Close flushes the rows, without closing the underlying writer
+	Close() error
+}
+
+// dataFile returns the path of the data file of table
+func (d *mySQL) dataFile(table string) string {
+	return filepath.Join(d.DataDir, table+d.Format.Extension())
+}
+
+// Dump the table data to its data file with the Format, in a single query.
+// Loaders get the absolute path of the file.
+func (d *mySQL) dumpTableFormat(ctx context.Context, w io.Writer, table string) (count int, err error) {
+	path := d.dataFile(table)
+	loader, isLoader := d.Format.(Loader)
+	if !isLoader {
+		fmt.Fprintf(w, "-- Data written to %s\n", path)
+	} else if err = d.getCharset(ctx); err != nil {
+		return
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	var columns []Column
+	count, err = d.dumpTableRows(ctx, f, table, func(w io.Writer, c []Column) (RowWriter, error) {
+		columns = c
+		return d.Format.NewRowWriter(w, columns)
+	})
+	if err == nil && isLoader {
+		// The client resolves relative paths from where it runs, not from
+		// where the dump is
+		if path, err = filepath.Abs(path); err != nil {
+			return
+		}
+		fmt.Fprintf(w, "%s\n", loader.LoadStatement(path, table, d.charset, columns))
+	}
+	return
+}
+
+// getCharset asks the character set of the results, which the data files
+// are written in, unless already known
+func (d *mySQL) getCharset(ctx context.Context) error {
+	if d.charset != "" {
+		return nil
+	}
+	var charset sql.NullString
+	if err := d.DB.QueryRowContext(ctx, "SELECT @@character_set_results").Scan(&charset); err != nil {
+		return err
+	}
+	// NULL means the results aren't converted
+	d.charset = "binary"
+	if charset.Valid {
+		d.charset = charset.String
+	}
+	return nil
+}
+
+// newRowWriter returns the RowWriter of the columns of a query
+type newRowWriter func(w io.Writer, columns []Column) (RowWriter, error)
+
+// Dump the table data to w with a RowWriter, in a single query
+func (d *mySQL) dumpTableRows(ctx context.Context, w io.Writer, table string, newWriter newRowWriter) (count int, err error) {
+	rows, names, err := d.selectAllDataFor(ctx, table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return d.writeRows(w, table, rows, names, newWriter)
+}
+
+// Write the rows with a RowWriter, reporting them to the observers in
+// batches of ExtendedInsertRows
+func (d *mySQL) writeRows(w io.Writer, table string, rows *sql.Rows, names []string, newWriter newRowWriter) (count int, err error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return
+	}
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i] = Column{Name: name, DataType: strings.ToLower(types[i].DatabaseTypeName())}
+		if precision, scale, ok := types[i].DecimalSize(); ok {
+			columns[i].Precision, columns[i].Scale = int(precision), int(scale)
+		}
+	}
+	counter := &countingWriter{w: w}
+	rw, err := newWriter(counter, columns)
+	if err != nil {
+		return
+	}
+
+	values := make([]*sql.RawBytes, len(columns))
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	var batch int
+	var reported int64
+	report := func() {
+		if batch == 0 && counter.n == reported {
+			return
+		}
+		d.rowsDumped(w, table, uint64(batch), uint64(counter.n-reported))
+		batch, reported = 0, counter.n
+	}
+	for rows.Next() {
+		if err = rows.Scan(scanArgs...); err != nil {
+			return
+		}
+		if err = rw.WriteRow(values); err != nil {
+			return
+		}
+		count++
+		if batch++; batch >= d.ExtendedInsertRows {
+			report()
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if err = rw.Close(); err != nil {
+		return
+	}
+	report()
+	return
+}
+
+// CSV writes RFC 4180 CSV, or TSV with a tab delimiter, with a header row of
+// column names. Fields are quoted when needed, or always with QuoteAll. NULL
+// is written as Null, and empty strings are quoted to tell them apart.
+type CSV struct {
+	Delimiter rune
+	QuoteAll  bool
+	Null      string
+}
+
+// NewCSV returns the RFC 4180 CSV format, with NULL as an empty field
+func NewCSV() *CSV {
+	return &CSV{Delimiter: ','}
+}
+
+// Extension is .tsv with a tab delimiter, and .csv otherwise
+func (f *CSV) Extension() string {
+	if f.Delimiter == '\t' {
+		return ".tsv"
+	}
+	return ".csv"
+}
+
+// NewRowWriter writes the header row and returns the writer of the rows
+func (f *CSV) NewRowWriter(w io.Writer, columns []Column) (RowWriter, error) {
+	cw := &csvWriter{CSV: f, w: bufio.NewWriter(w)}
+	for i, column := range columns {
+		cw.writeField(i, []byte(column.Name))
+	}
+	_, err := cw.w.WriteString("\r\n")
+	return cw, err
+}
+
+type csvWriter struct {
+	*CSV
+	w *bufio.Writer
+}
+
+func (cw *csvWriter) WriteRow(values []*sql.RawBytes) error {
+	for i, value := range values {
+		if value == nil {
+			if i > 0 {
+				cw.w.WriteRune(cw.Delimiter)
+			}
+			cw.w.WriteString(cw.Null)
+			continue
+		}
+		cw.writeField(i, *value)
+	}
+	_, err := cw.w.WriteString("\r\n")
+	return err
+}
+
+func (cw *csvWriter) writeField(i int, field []byte) {
+	if i > 0 {
+		cw.w.WriteRune(cw.Delimiter)
+	}
+	if !cw.needsQuotes(field) {
+		cw.w.Write(field)
+		return
+	}
+	cw.w.WriteByte('"')
+	cw.w.Write(bytes.ReplaceAll(field, []byte(`"`), []byte(`""`)))
+	cw.w.WriteByte('"')
+}
+
+func (cw *csvWriter) needsQuotes(field []byte) bool {
+	return cw.QuoteAll || len(field) == 0 || string(field) == cw.Null ||
+		bytes.ContainsRune(field, cw.Delimiter) || bytes.ContainsAny(field, "\"\r\n")
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.w.Flush()
+}
+
+// JSONLines writes each row as a JSON object keyed by column name, one per
+// line. Numbers are written as JSON numbers, NULL as null, binary data as
+// base64 strings and JSON columns are embedded as they are.
+type JSONLines struct{}
+
+// NewJSONLines returns the JSON Lines format
+func NewJSONLines() *JSONLines {
+	return &JSONLines{}
+}
+
+// Extension is .jsonl
+func (f *JSONLines) Extension() string {
+	return ".jsonl"
+}
+
+// NewRowWriter returns the writer of the rows, with the kind of each column
+// derived from its type
+func (f *JSONLines) NewRowWriter(w io.Writer, columns []Column) (RowWriter, error) {
+	jw := &jsonWriter{w: bufio.NewWriter(w)}
+	jw.encoder = json.NewEncoder(&jw.buf)
+	jw.encoder.SetEscapeHTML(false)
+	for i, column := range columns {
+		jw.buf.Reset()
+		if i == 0 {
+			jw.buf.WriteByte('{')
+		} else {
+			jw.buf.WriteByte(',')
+		}
+		if err := jw.encoder.Encode(column.Name); err != nil {
+			return nil, err
+		}
+		key := append([]byte(nil), bytes.TrimRight(jw.buf.Bytes(), "\n")...)
+		jw.keys = append(jw.keys, append(key, ':'))
+		jw.kinds = append(jw.kinds, jsonKindOf(column.DataType))
+	}
+	return jw, nil
+}
+
+type jsonKind int
+
+const (
+	jsonString jsonKind = iota
+	jsonNumber
+	jsonBinary
+	jsonRaw
+)
+
+// binaryTypes are the types of the MySQL driver holding bytes, not text
+var binaryTypes = map[string]bool{
+	"binary": true, "varbinary": true, "tinyblob": true, "blob": true, "mediumblob": true, "longblob": true,
+	"bit": true, "geometry": true,
+}
+
+// spatialTypes are the DATA_TYPE of information_schema for spatial columns,
+// which the MySQL driver names GEOMETRY
+var spatialTypes = map[string]bool{
+	"geometry": true, "point": true, "linestring": true, "polygon": true, "multipoint": true,
+	"multilinestring": true, "multipolygon": true, "geometrycollection": true, "geomcollection": true,
+}
+
+// jsonKindOf maps the type names of the MySQL driver, like UNSIGNED INT or
+// VARBINARY, to the way their values are written
+func jsonKindOf(dataType string) jsonKind {
+	dataType = strings.ToLower(dataType)
+	if binaryTypes[dataType] {
+		return jsonBinary
+	}
+	switch strings.TrimPrefix(dataType, "unsigned ") {
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "year":
+		return jsonNumber
+	case "json":
+		return jsonRaw
+	}
+	return jsonString
+}
+
+type jsonWriter struct {
+	w       *bufio.Writer
+	buf     bytes.Buffer
+	encoder *json.Encoder
+	keys    [][]byte
+	kinds   []jsonKind
+}
+
+func (jw *jsonWriter) WriteRow(values []*sql.RawBytes) (err error) {
+	for i, value := range values {
+		jw.w.Write(jw.keys[i])
+		if err = jw.writeValue(jw.kinds[i], value); err != nil {
+			return
+		}
+	}
+	if len(values) == 0 {
+		jw.w.WriteByte('{')
+	}
+	_, err = jw.w.WriteString("}\n")
+	return
+}
+
+// writeValue writes values that aren't valid as numbers or JSON, which
+// shouldn't come from MySQL, as strings
+func (jw *jsonWriter) writeValue(kind jsonKind, value *sql.RawBytes) error {
+	if value == nil {
+		_, err := jw.w.WriteString("null")
+		return err
+	}
+	switch kind {
+	case jsonNumber:
+		if json.Valid(*value) {
+			_, err := jw.w.Write(*value)
+			return err
+		}
+	case jsonRaw:
+		jw.buf.Reset()
+		// Compacted, so newlines in the document don't break the line
+		if json.Compact(&jw.buf, *value) == nil {
+			_, err := jw.buf.WriteTo(jw.w)
+			return err
+		}
+	case jsonBinary:
+		jw.w.WriteByte('"')
+		encoder := base64.NewEncoder(base64.StdEncoding, jw.w)
+		encoder.Write(*value)
+		encoder.Close()
+		return jw.w.WriteByte('"')
+	}
+	jw.buf.Reset()
+	if err := jw.encoder.Encode(string(*value)); err != nil {
+		return err
+	}
+	_, err := jw.w.Write(bytes.TrimRight(jw.buf.Bytes(), "\n"))
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	return jw.w.Flush()
+}
+
+// LoadData writes data files in the default format of LOAD DATA INFILE: tab
+// separated fields, lines ended by a newline, NULL as \N and backslash escapes
+// for backslashes, tabs, newlines and NUL bytes.
+type LoadData struct{}
+
+// NewLoadData returns the LOAD DATA INFILE format
+func NewLoadData() *LoadData {
+	return &LoadData{}
+}
+
+// Extension is .txt, like the data files of mysqldump --tab
+func (f *LoadData) Extension() string {
+	return ".txt"
+}
+
+// LoadStatement returns the LOAD DATA LOCAL INFILE statement of the data file.
+// Relative paths are relative to the directory where the client runs.
+func (f *LoadData) LoadStatement(path, table, charset string, columns []Column) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = fmt.Sprintf("`%s`", column.Name)
+	}
+	return fmt.Sprintf("LOAD DATA LOCAL INFILE '%s' INTO TABLE `%s` CHARACTER SET %s "+
+		"FIELDS TERMINATED BY '\\t' ESCAPED BY '\\\\' LINES TERMINATED BY '\\n' (%s);",
+		escape(path), table, charset, strings.Join(names, ", "))
+}
+
+// NewRowWriter returns the writer of the rows, as the files have no header
+func (f *LoadData) NewRowWriter(w io.Writer, columns []Column) (RowWriter, error) {
+	return &loadDataWriter{w: bufio.NewWriter(w)}, nil
+}
+
+type loadDataWriter struct {
+	w *bufio.Writer
+}
+
+func (lw *loadDataWriter) WriteRow(values []*sql.RawBytes) error {
+	for i, value := range values {
+		if i > 0 {
+			lw.w.WriteByte('\t')
+		}
+		if value == nil {
+			lw.w.WriteString(`\N`)
+			continue
+		}
+		last := 0
+		for j, c := range *value {
+			var esc string
+			switch c {
+			case '\\':
+				esc = `\\`
+			case '\t':
+				esc = `\t`
+			case '\n':
+				esc = `\n`
+			case 0:
+				esc = `\0`
+			default:
+				continue
+			}
+			lw.w.Write((*value)[last:j])
+			lw.w.WriteString(esc)
+			last = j + 1
+		}
+		lw.w.Write((*value)[last:])
+	}
+	_, err := lw.w.WriteString("\n")
+	return err
+}
+
+func (lw *loadDataWriter) Close() error {
+	return lw.w.Flush()
+}
@@ -0,0 +1,150 @@
+package dumper
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func rawBytes(values ...interface{}) []*sql.RawBytes {
+	raw := make([]*sql.RawBytes, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			b := sql.RawBytes(s)
+			raw[i] = &b
+		}
+	}
+	return raw
+}
+
+func TestCSVQuoting(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	rw, err := NewCSV().NewRowWriter(buffer, []Column{{Name: "id"}, {Name: "note"}})
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "plain")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", "a, \"quoted\"\nline")))
+	assert.Nil(t, rw.WriteRow(rawBytes("3", "")))
+	assert.Nil(t, rw.WriteRow(rawBytes("4", nil)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, "id,note\r\n1,plain\r\n2,\"a, \"\"quoted\"\"\nline\"\r\n3,\"\"\r\n4,\r\n", buffer.String())
+}
+
+func TestCSVWithNullAndQuoteAll(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	format := &CSV{Delimiter: '\t', QuoteAll: true, Null: `\N`}
+	assert.Equal(t, ".tsv", format.Extension())
+	rw, err := format.NewRowWriter(buffer, []Column{{Name: "id"}, {Name: "note"}})
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", nil)))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", `\N`)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, "\"id\"\t\"note\"\r\n\"1\"\t\\N\r\n\"2\"\t\"\\N\"\r\n", buffer.String())
+}
+
+func TestMySQLDumpTableDataWithFormat(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Format = NewCSV()
+	dumper.DataDir = t.TempDir()
+	dumper.WhereMap = map[string]string{"table": "id < 3"}
+
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "language"}).AddRow(1, "Go"))
+	mock.ExpectQuery("SELECT `id`, `language` FROM `table` WHERE id < 3").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "language"}).
+			AddRow(1, "Go").
+			AddRow(2, nil))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	path := filepath.Join(dumper.DataDir, "table.csv")
+	assert.Equal(t, "-- Data written to "+path+"\n", buffer.String())
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "id,language\r\n1,Go\r\n2,\r\n", string(data))
+}
+
+func TestJSONLines(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{
+		{Name: "id", DataType: "UNSIGNED BIGINT"},
+		{Name: "price", DataType: "DECIMAL"},
+		{Name: "name", DataType: "VARCHAR"},
+		{Name: "photo", DataType: "BLOB"},
+		{Name: "attrs", DataType: "JSON"},
+	}
+	rw, err := NewJSONLines().NewRowWriter(buffer, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "9.90", "<Tom> \"T\"\n", "\x00\xff", "{\"a\": [1,\n 2]}")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", nil, nil, nil, nil)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, `{"id":1,"price":9.90,"name":"<Tom> \"T\"\n","photo":"AP8=","attrs":{"a":[1,2]}}`+"\n"+
+		`{"id":2,"price":null,"name":null,"photo":null,"attrs":null}`+"\n", buffer.String())
+}
+
+func TestLoadDataEscaping(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	rw, err := NewLoadData().NewRowWriter(buffer, []Column{{Name: "id"}, {Name: "note"}})
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "a\tb\nc\\d\x00")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", nil)))
+	assert.Nil(t, rw.WriteRow(rawBytes("3", `\N`)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, "1\ta\\tb\\nc\\\\d\\0\n2\t\\N\n3\t\\\\N\n", buffer.String())
+}
+
+func TestMySQLDumpTableDataWithLoadData(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Format = NewLoadData()
+	dumper.DataDir = t.TempDir()
+
+	mock.ExpectQuery("SELECT @@character_set_results").WillReturnRows(
+		sqlmock.NewRows([]string{"@@character_set_results"}).AddRow("utf8mb4"))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "language"}).AddRow(1, "Go"))
+	mock.ExpectQuery("SELECT `id`, `language` FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "language"}).
+			AddRow(1, "Go").
+			AddRow(2, nil))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	path := filepath.Join(dumper.DataDir, "table.txt")
+	assert.Equal(t, "LOAD DATA LOCAL INFILE '"+path+"' INTO TABLE `table` CHARACTER SET utf8mb4 "+
+		`FIELDS TERMINATED BY '\t' ESCAPED BY '\\' LINES TERMINATED BY '\n' (`+"`id`, `language`);\n", buffer.String())
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "1\tGo\n2\t\\N\n", string(data))
+}
+
+func TestMySQLDumpTableDataWithLoadDataInRelativeDir(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Format = NewLoadData()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	dumper.DataDir, err = filepath.Rel(wd, dir)
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("SELECT @@character_set_results").WillReturnRows(
+		sqlmock.NewRows([]string{"@@character_set_results"}).AddRow("utf8mb4"))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.True(t, strings.HasPrefix(buffer.String(), "LOAD DATA LOCAL INFILE '"+filepath.Join(dir, "table.txt")+"' "))
+}
@@ -1,12 +1,14 @@
 package dumper
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 )
 
 // ExtendedInsertDefaultRowCount: Default rows that will be dumped by each INSERT statement
@@ -14,47 +16,92 @@ const (
 	ExtendedInsertDefaultRowCount = 100
 )
 
+// sqlSession are the session settings beginning the dump, and each of its
+// parts when split
+const sqlSession = "SET NAMES utf8;\nSET FOREIGN_KEY_CHECKS = 0;\n"
+
 type mySQL struct {
+	Rules
 	DB                 *sql.DB
-	SelectMap          map[string]map[string]string
-	WhereMap           map[string]string
-	FilterMap          map[string]string
+	lockConn           *sql.Conn
+	InsertRowsMap      map[string]int
 	UseTableLock       bool
-	Log                *log.Logger
+	Log                *slog.Logger
 	ExtendedInsertRows int
+	ChunkSize          int
+	Retry              RetryPolicy
+	Observers          []Observer
+	Checkpoint         *Checkpoint
+	Policy             *Policy
+	Format             Format
+	DataDir            string
+	Dialect            Dialect
+	out                *countingWriter
+	split              *SplitWriter
+	// charset of the results, asked once for LOAD DATA statements
+	charset string
 }
 
-// NewMySQLDumper is the constructor
-func NewMySQLDumper(db *sql.DB, logger *log.Logger) *mySQL {
+// NewMySQLDumper is the constructor. A nil logger discards the logs.
+func NewMySQLDumper(db *sql.DB, logger *slog.Logger) *mySQL {
 	if logger == nil {
-		logger = log.New(ioutil.Discard, "", 0)
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
 	}
 	return &mySQL{DB: db, Log: logger, ExtendedInsertRows: ExtendedInsertDefaultRowCount}
 }
 
+// Table locks belong to the connection that took them, so while a dump is
+// running they are taken and released through a dedicated connection.
+func (d *mySQL) lockExecContext(ctx context.Context, query string) (sql.Result, error) {
+	if d.lockConn != nil {
+		return d.lockConn.ExecContext(ctx, query)
+	}
+	return d.DB.ExecContext(ctx, query)
+}
+
 // Lock the table (read only)
 func (d *mySQL) LockTableReading(table string) (sql.Result, error) {
-	d.Log.Println("Locking table", table, "for reading")
-	return d.DB.Exec(fmt.Sprintf("LOCK TABLES `%s` READ", table))
+	return d.LockTableReadingContext(context.Background(), table)
+}
+
+// LockTableReadingContext is like LockTableReading, but honors ctx
+func (d *mySQL) LockTableReadingContext(ctx context.Context, table string) (sql.Result, error) {
+	d.Log.Debug("Locking table for reading", "table", table, "phase", "lock")
+	return d.lockExecContext(ctx, fmt.Sprintf("LOCK TABLES `%s` READ", table))
 }
 
 // Flush table to ensure that the all active index pages are written to disk
 func (d *mySQL) FlushTable(table string) (sql.Result, error) {
-	d.Log.Println("Flushing table", table)
-	return d.DB.Exec(fmt.Sprintf("FLUSH TABLES `%s`", table))
+	return d.FlushTableContext(context.Background(), table)
+}
+
+// FlushTableContext is like FlushTable, but honors ctx
+func (d *mySQL) FlushTableContext(ctx context.Context, table string) (sql.Result, error) {
+	d.Log.Debug("Flushing table", "table", table, "phase", "lock")
+	return d.lockExecContext(ctx, fmt.Sprintf("FLUSH TABLES `%s`", table))
 }
 
 // Release the global read locks
 func (d *mySQL) UnlockTables() (sql.Result, error) {
-	d.Log.Println("Unlocking tables")
-	return d.DB.Exec(fmt.Sprintf("UNLOCK TABLES"))
+	return d.UnlockTablesContext(context.Background())
+}
+
+// UnlockTablesContext is like UnlockTables, but honors ctx
+func (d *mySQL) UnlockTablesContext(ctx context.Context) (sql.Result, error) {
+	d.Log.Debug("Unlocking tables", "phase", "unlock")
+	return d.lockExecContext(ctx, "UNLOCK TABLES")
 }
 
 // Get list of existing tables in database
 func (d *mySQL) GetTables() (tables []string, err error) {
+	return d.GetTablesContext(context.Background())
+}
+
+// GetTablesContext is like GetTables, but honors ctx
+func (d *mySQL) GetTablesContext(ctx context.Context) (tables []string, err error) {
 	tables = make([]string, 0)
 	var rows *sql.Rows
-	if rows, err = d.DB.Query("SHOW FULL TABLES"); err != nil {
+	if rows, err = d.DB.QueryContext(ctx, "SHOW FULL TABLES"); err != nil {
 		return
 	}
 	defer rows.Close()
@@ -67,15 +114,21 @@ func (d *mySQL) GetTables() (tables []string, err error) {
 			tables = append(tables, tableName)
 		}
 	}
+	err = rows.Err()
 	return
 }
 
 // Dump the script to create the table
 func (d *mySQL) DumpCreateTable(w io.Writer, table string) error {
-	d.Log.Println("Dumping structure for table", table)
+	return d.DumpCreateTableContext(context.Background(), w, table)
+}
+
+// DumpCreateTableContext is like DumpCreateTable, but honors ctx
+func (d *mySQL) DumpCreateTableContext(ctx context.Context, w io.Writer, table string) error {
+	d.Log.Info("Dumping structure", "table", table, "phase", "schema")
 	fmt.Fprintf(w, "\n--\n-- Structure for table `%s`\n--\n\n", table)
 	fmt.Fprintf(w, "DROP TABLE IF EXISTS `%s`;\n", table)
-	row := d.DB.QueryRow(fmt.Sprintf("SHOW CREATE TABLE `%s`", table))
+	row := d.DB.QueryRowContext(ctx, fmt.Sprintf("SHOW CREATE TABLE `%s`", table))
 	var tname, ddl string
 	if err := row.Scan(&tname, &ddl); err != nil {
 		return err
@@ -86,31 +139,60 @@ func (d *mySQL) DumpCreateTable(w io.Writer, table string) error {
 
 // Get the column list for the SELECT, applying the select map from config file.
 func (d *mySQL) GetColumnsForSelect(table string) (columns []string, err error) {
+	return d.GetColumnsForSelectContext(context.Background(), table)
+}
+
+// GetColumnsForSelectContext is like GetColumnsForSelect, but honors ctx
+func (d *mySQL) GetColumnsForSelectContext(ctx context.Context, table string) (columns []string, err error) {
 	var rows *sql.Rows
-	if rows, err = d.DB.Query(fmt.Sprintf("SELECT * FROM `%s` LIMIT 1", table)); err != nil {
+	if rows, err = d.DB.QueryContext(ctx, fmt.Sprintf("SELECT * FROM `%s` LIMIT 1", table)); err != nil {
 		return
 	}
 	defer rows.Close()
 	if columns, err = rows.Columns(); err != nil {
 		return
 	}
+	return d.selectColumns(table, columns), nil
+}
+
+// Quote the column names, replacing them by the select map expressions
+func (d *mySQL) selectColumns(table string, columns []string) []string {
+	selected := make([]string, len(columns))
 	for k, column := range columns {
 		replacement, ok := d.SelectMap[strings.ToLower(table)][strings.ToLower(column)]
 		if ok {
-			columns[k] = fmt.Sprintf("%s AS `%s`", replacement, column)
+			selected[k] = fmt.Sprintf("%s AS `%s`", replacement, column)
 		} else {
-			columns[k] = fmt.Sprintf("`%s`", column)
+			selected[k] = fmt.Sprintf("`%s`", column)
 		}
 	}
-	return
+	return selected
 }
 
 // Get the complete SELECT query to fetch data from database
 func (d *mySQL) GetSelectQueryFor(table string) (query string, err error) {
-	cols, err := d.GetColumnsForSelect(table)
+	return d.GetSelectQueryForContext(context.Background(), table)
+}
+
+// GetSelectQueryForContext is like GetSelectQueryFor, but honors ctx
+func (d *mySQL) GetSelectQueryForContext(ctx context.Context, table string) (query string, err error) {
+	cols, err := d.GetColumnsForSelectContext(ctx, table)
 	if err != nil {
 		return "", err
 	}
+	return d.selectQuery(table, cols), nil
+}
+
+func (d *mySQL) selectQuery(table string, cols []string) (query string) {
+	query = d.whereQuery(table, cols)
+	if sample := d.SampleMap[strings.ToLower(table)]; sample > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, sample)
+	}
+	return
+}
+
+// Get the SELECT query filtered by the WHERE rule, but not sampled
+func (d *mySQL) whereQuery(table string, cols []string) (query string) {
 	query = fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(cols, ", "), table)
 	if where, ok := d.WhereMap[strings.ToLower(table)]; ok {
 		query = fmt.Sprintf("%s WHERE %s", query, where)
@@ -118,23 +200,61 @@ func (d *mySQL) GetSelectQueryFor(table string) (query string, err error) {
 	return
 }
 
+// Get the SELECT query for a chunk ordered by key. Unless it's the first one,
+// the chunk starts after the key given as query argument.
+func (d *mySQL) chunkQuery(table string, cols []string, key chunkKey, first bool) string {
+	query := fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(cols, ", "), table)
+	var conds []string
+	if where, ok := d.WhereMap[strings.ToLower(table)]; ok {
+		conds = append(conds, fmt.Sprintf("(%s)", where))
+	}
+	if !first {
+		conds = append(conds, key.after("?"))
+	}
+	if len(conds) > 0 {
+		query = fmt.Sprintf("%s WHERE %s", query, strings.Join(conds, " AND "))
+	}
+	return fmt.Sprintf("%s ORDER BY `%s` LIMIT %d", query, key.Name, d.ChunkSize)
+}
+
 // Get the number of rows the select will return
 func (d *mySQL) GetRowCount(table string) (count uint64, err error) {
-	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table)
+	return d.GetRowCountContext(context.Background(), table)
+}
+
+// GetRowCountContext is like GetRowCount, but honors ctx
+func (d *mySQL) GetRowCountContext(ctx context.Context, table string) (count uint64, err error) {
+	query := d.countQuery(table)
+	d.Log.Debug("Counting rows", "table", table, "phase", "count", "query", query)
+	err = d.retry(ctx, "row count of table "+table, func() error {
+		started := time.Now()
+		err := d.DB.QueryRowContext(ctx, query).Scan(&count)
+		d.queryDone("row_count", started, err)
+		return err
+	})
+	return
+}
+
+func (d *mySQL) countQuery(table string) (query string) {
+	if sample := d.SampleMap[strings.ToLower(table)]; sample > 0 {
+		return fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS `sample`", d.selectQuery(table, []string{"1"}))
+	}
+	query = fmt.Sprintf("SELECT COUNT(*) FROM `%s`", table)
 	if where, ok := d.WhereMap[strings.ToLower(table)]; ok {
 		query = fmt.Sprintf("%s WHERE %s", query, where)
 	}
-	row := d.DB.QueryRow(query)
-	if err = row.Scan(&count); err != nil {
-		return
-	}
 	return
 }
 
 // Dump comments including table name and row count to w
 func (d *mySQL) DumpTableHeader(w io.Writer, table string) (count uint64, err error) {
+	return d.DumpTableHeaderContext(context.Background(), w, table)
+}
+
+// DumpTableHeaderContext is like DumpTableHeader, but honors ctx
+func (d *mySQL) DumpTableHeaderContext(ctx context.Context, w io.Writer, table string) (count uint64, err error) {
 	fmt.Fprintf(w, "\n--\n-- Data for table `%s`", table)
-	if count, err = d.GetRowCount(table); err != nil {
+	if count, err = d.GetRowCountContext(ctx, table); err != nil {
 		return
 	}
 	fmt.Fprintf(w, " -- %d rows\n--\n\n", count)
@@ -151,12 +271,20 @@ func (d *mySQL) DumpUnlockTables(w io.Writer) {
 	fmt.Fprintln(w, "UNLOCK TABLES;")
 }
 
-func (d *mySQL) selectAllDataFor(table string) (rows *sql.Rows, columns []string, err error) {
+func (d *mySQL) selectAllDataFor(ctx context.Context, table string) (rows *sql.Rows, columns []string, err error) {
 	var selectQuery string
-	if selectQuery, err = d.GetSelectQueryFor(table); err != nil {
+	if selectQuery, err = d.GetSelectQueryForContext(ctx, table); err != nil {
 		return
 	}
-	if rows, err = d.DB.Query(selectQuery); err != nil {
+	d.Log.Debug("Querying data", "table", table, "phase", "data", "query", selectQuery)
+	// Nothing is written before the query returns, so it's safe to retry
+	err = d.retry(ctx, "data of table "+table, func() error {
+		started := time.Now()
+		rows, err = d.DB.QueryContext(ctx, selectQuery)
+		d.queryDone("select_data", started, err)
+		return err
+	})
+	if err != nil {
 		return
 	}
 	if columns, err = rows.Columns(); err != nil {
@@ -167,12 +295,152 @@ func (d *mySQL) selectAllDataFor(table string) (rows *sql.Rows, columns []string
 
 // Get the table data
 func (d *mySQL) DumpTableData(w io.Writer, table string) (err error) {
-	d.Log.Println("Dumping data for table", table)
-	rows, columns, err := d.selectAllDataFor(table)
+	return d.DumpTableDataContext(context.Background(), w, table)
+}
+
+// DumpTableDataContext is like DumpTableData, but honors ctx. With a Format,
+// the data is written to its own file, and with a Dialect, in its language.
+// Otherwise, when ChunkSize is set and the table has a single column primary
+// key, the data is fetched in chunks ordered by that key.
+func (d *mySQL) DumpTableDataContext(ctx context.Context, w io.Writer, table string) error {
+	return d.logTableData(table, func() (int, error) {
+		return d.dumpTableData(ctx, w, table)
+	})
+}
+
+// logTableData logs the start and the end of dumping the data of a table
+func (d *mySQL) logTableData(table string, dump func() (int, error)) error {
+	d.Log.Info("Dumping data", "table", table, "phase", "data")
+	started := time.Now()
+	count, err := dump()
+	if err == nil {
+		d.Log.Info("Dumped data", "table", table, "phase", "data", "rows", count,
+			"duration", time.Since(started))
+	}
+	return err
+}
+
+// Dump the table data, returning the number of rows
+func (d *mySQL) dumpTableData(ctx context.Context, w io.Writer, table string) (count int, err error) {
+	if d.Format != nil {
+		return d.dumpTableFormat(ctx, w, table)
+	}
+	if d.Dialect != nil {
+		var schema *TableSchema
+		if schema, err = d.GetTableSchema(ctx, table); err != nil {
+			return
+		}
+		return d.dumpTableRows(ctx, w, table, func(w io.Writer, columns []Column) (RowWriter, error) {
+			return d.Dialect.NewRowWriter(w, schema, columns)
+		})
+	}
+	if d.ChunkSize > 0 {
+		var key chunkKey
+		if key, err = d.GetChunkKey(ctx, table); err != nil {
+			return
+		}
+		if key.Name != "" {
+			return d.dumpTableChunks(ctx, w, table, key, "")
+		}
+	}
+	rows, columns, err := d.selectAllDataFor(ctx, table)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
+	_, count, err = d.writeInserts(w, table, rows, columns, "")
+	return
+}
+
+// Continue the data of a table interrupted after the chunk ending at lastKey.
+// Rows after it are deleted first, in case a partial chunk was already loaded.
+func (d *mySQL) resumeTableData(ctx context.Context, w io.Writer, table, lastKey string) (err error) {
+	d.Log.Info("Resuming data", "table", table, "phase", "data", "last_key", lastKey)
+	key, err := d.GetChunkKey(ctx, table)
+	if err != nil {
+		return
+	}
+	if key.Name == "" {
+		return errors.New("Can't resume table " + table + ", it has no single column primary key")
+	}
+	fmt.Fprintf(w, "\n--\n-- Resuming data for table `%s` after `%s` = '%s'\n--\n\n", table, key.Name, escape(lastKey))
+	d.DumpTableLockWrite(w, table)
+	fmt.Fprintf(w, "DELETE FROM `%s` WHERE %s;\n", table, key.after("'"+escape(lastKey)+"'"))
+	started := time.Now()
+	count, err := d.dumpTableChunks(ctx, w, table, key, lastKey)
+	if err != nil {
+		return
+	}
+	d.Log.Info("Dumped data", "table", table, "phase", "data", "rows", count, "duration", time.Since(started))
+	fmt.Fprintln(w)
+	d.DumpUnlockTables(w)
+	return
+}
+
+// Dump the table data in chunks of ChunkSize rows, ordered by key and starting
+// after lastKey. The checkpoint, if any, is advanced after each chunk. The
+// number of rows dumped is returned.
+func (d *mySQL) dumpTableChunks(ctx context.Context, w io.Writer, table string, key chunkKey, lastKey string) (total int, err error) {
+	cols, err := d.GetColumnsForSelectContext(ctx, table)
+	if err != nil {
+		return
+	}
+	for {
+		var args []interface{}
+		if lastKey != "" {
+			args = append(args, lastKey)
+		}
+		query := d.chunkQuery(table, cols, key, lastKey == "")
+
+		var chunkEnd string
+		var count int
+		unit := fmt.Sprintf("chunk of table %s after key '%s'", table, lastKey)
+		d.Log.Debug("Querying chunk", "table", table, "phase", "data", "query", query, "last_key", lastKey)
+		err = d.retryOutput(ctx, w, table, unit, func(w io.Writer) error {
+			started := time.Now()
+			rows, err := d.DB.QueryContext(ctx, query, args...)
+			d.queryDone("select_chunk", started, err)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			columns, err := rows.Columns()
+			if err != nil {
+				return err
+			}
+			chunkEnd, count, err = d.writeInserts(w, table, rows, columns, key.Name)
+			return err
+		})
+		if err != nil || count == 0 {
+			return
+		}
+		if err = d.boundary(w); err != nil {
+			return
+		}
+		total += count
+		if lastKey = chunkEnd; lastKey == "" {
+			return total, errors.New("Can't find primary key " + key.Name + " in chunk of table " + table)
+		}
+		if d.Checkpoint != nil && d.out != nil {
+			if err = d.Checkpoint.advance(table, lastKey, d.out.n); err != nil {
+				return
+			}
+		}
+		if count < d.ChunkSize {
+			return
+		}
+	}
+}
+
+// Write the rows as extended INSERT statements. If key is given, the value of
+// that column in the last row is returned, along with the number of rows.
+func (d *mySQL) writeInserts(w io.Writer, table string, rows *sql.Rows, columns []string, key string) (lastKey string, count int, err error) {
+	keyIndex := -1
+	for i, column := range columns {
+		if key != "" && column == key {
+			keyIndex = i
+		}
+	}
 
 	values := make([]*sql.RawBytes, len(columns))
 	scanArgs := make([]interface{}, len(values))
@@ -180,11 +448,19 @@ func (d *mySQL) DumpTableData(w io.Writer, table string) (err error) {
 		scanArgs[i] = &values[i]
 	}
 
+	rowsPerInsert := d.ExtendedInsertRows
+	if n := d.InsertRowsMap[strings.ToLower(table)]; n > 0 {
+		rowsPerInsert = n
+	}
 	query := fmt.Sprintf("INSERT INTO `%s` VALUES", table)
 	var data []string
 	for rows.Next() {
 		if err = rows.Scan(scanArgs...); err != nil {
-			return err
+			return
+		}
+		count++
+		if keyIndex >= 0 && values[keyIndex] != nil {
+			lastKey = string(*values[keyIndex])
 		}
 		var vals []string
 		for _, col := range values {
@@ -196,55 +472,218 @@ func (d *mySQL) DumpTableData(w io.Writer, table string) (err error) {
 		}
 
 		data = append(data, fmt.Sprintf("( %s )", strings.Join(vals, ", ")))
-		if len(data) >= d.ExtendedInsertRows {
-			fmt.Fprintf(w, "%s\n%s;\n", query, strings.Join(data, ",\n"))
+		if len(data) >= rowsPerInsert {
+			if err = d.writeInsert(w, table, query, data); err != nil {
+				return
+			}
 			data = make([]string, 0)
 		}
 	}
 
+	if err = rows.Err(); err != nil {
+		return
+	}
+
 	if len(data) > 0 {
-		fmt.Fprintf(w, "%s\n%s;\n", query, strings.Join(data, ",\n"))
+		err = d.writeInsert(w, table, query, data)
 	}
 
 	return
 }
 
-func (d *mySQL) Dump(w io.Writer) (err error) {
-	fmt.Fprintf(w, "SET NAMES utf8;\n")
-	fmt.Fprintf(w, "SET FOREIGN_KEY_CHECKS = 0;\n")
+func (d *mySQL) writeInsert(w io.Writer, table, query string, data []string) error {
+	n, _ := fmt.Fprintf(w, "%s\n%s;\n", query, strings.Join(data, ",\n"))
+	d.rowsDumped(w, table, uint64(len(data)), uint64(n))
+	return d.boundary(w)
+}
+
+// boundary lets a split output roll over to its next part, once the
+// statements written to w are complete. Output buffered for retries isn't
+// written yet, so it rolls over after the table, or the chunk.
+func (d *mySQL) boundary(w io.Writer) error {
+	if d.split == nil || w != io.Writer(d.out) {
+		return nil
+	}
+	return d.split.Boundary()
+}
+
+// Dump writes the whole database to w. If ctx is canceled, or any step fails,
+// the table locks are released and a "Dump aborted" marker is written to w.
+// With a Checkpoint, the progress is saved as it goes, and tables already
+// completed in it are skipped. With a SplitWriter, the dump rolls over to its
+// next part after an INSERT statement or a table.
+func (d *mySQL) Dump(ctx context.Context, w io.Writer) (err error) {
+	// Scripts of dialects run in a single transaction, so they aren't split
+	d.split = nil
+	if s, ok := w.(*SplitWriter); ok && d.Dialect == nil {
+		s.Header = sqlSession
+		d.split = s
+	}
+	d.out = &countingWriter{w: w}
+	if d.Checkpoint != nil {
+		d.out.n = d.Checkpoint.Offset
+	}
+	w = d.out
+	defer func() {
+		d.notify(func(o Observer) { o.DumpFinished(err) })
+	}()
+
+	if err = d.enforcePolicy(ctx); err != nil {
+		return
+	}
+
+	if d.UseTableLock {
+		if d.lockConn, err = d.DB.Conn(ctx); err != nil {
+			return
+		}
+		defer func() {
+			d.lockConn.Close()
+			d.lockConn = nil
+		}()
+	}
+
+	if d.Dialect == nil {
+		io.WriteString(w, sqlSession)
+	} else if d.Checkpoint == nil || d.Checkpoint.Offset == 0 {
+		// A resumed dump continues the output, which already began
+		var database string
+		if database, err = d.GetDatabase(ctx); err != nil {
+			return
+		}
+		d.Dialect.Begin(w, database)
+	}
+
+	if err = d.dumpTables(ctx, w); err != nil {
+		if d.Dialect != nil {
+			d.Dialect.Aborted(w, err)
+		} else {
+			fmt.Fprintf(w, "\n-- Dump aborted: %s\n", err)
+		}
+		return
+	}
+
+	if d.Dialect != nil {
+		d.Dialect.End(w)
+	} else {
+		fmt.Fprintf(w, "SET FOREIGN_KEY_CHECKS = 1;\n")
+	}
+	if d.Checkpoint != nil {
+		err = d.Checkpoint.finish(d.out.n)
+	}
+	return
+}
 
-	d.Log.Println("Getting table list...")
-	tables, err := d.GetTables()
+func (d *mySQL) dumpTables(ctx context.Context, w io.Writer) (err error) {
+	d.Log.Debug("Getting table list", "phase", "tables")
+	tables, err := d.GetTablesContext(ctx)
 	if err != nil {
 		return
 	}
-	
+
+	var pending []string
 	for _, table := range tables {
-		if d.FilterMap[strings.ToLower(table)] != "ignore" {
-			skipData := d.FilterMap[strings.ToLower(table)] == "nodata"
-			if !skipData && d.UseTableLock {
-				d.LockTableReading(table)
-				d.FlushTable(table)
+		if d.filter(table) == "ignore" {
+			d.notify(func(o Observer) { o.TableSkipped(table, "ignore") })
+			continue
+		}
+		if d.Checkpoint != nil && d.Checkpoint.IsCompleted(table) {
+			d.Log.Info("Skipping table completed in checkpoint", "table", table, "phase", "resume")
+			continue
+		}
+		pending = append(pending, table)
+	}
+
+	if len(d.Observers) > 0 {
+		var estimates map[string]TableEstimate
+		if estimates, err = d.GetTableEstimates(ctx); err != nil {
+			return
+		}
+		estimatedRows := make(map[string]uint64)
+		for _, table := range pending {
+			if d.filter(table) != "nodata" {
+				estimatedRows[table] = estimates[table].Rows
 			}
-			d.DumpCreateTable(w, table)
-			if !skipData {
-				cnt, err := d.DumpTableHeader(w, table)
-				if err != nil {
-					return err
-				}
-				if cnt > 0 {
-					d.DumpTableLockWrite(w, table)
-					d.DumpTableData(w, table)
-					fmt.Fprintln(w)
-					d.DumpUnlockTables(w)
-					if d.UseTableLock {
-						d.UnlockTables()
-					}
-				}
+		}
+		d.notify(func(o Observer) { o.DumpStarted(estimatedRows) })
+	}
+
+	for _, table := range pending {
+		if err = d.dumpTable(ctx, w, table); err != nil {
+			return
+		}
+		if err = d.boundary(w); err != nil {
+			return
+		}
+		if d.Checkpoint != nil {
+			if err = d.Checkpoint.complete(table, d.out.n); err != nil {
+				return
 			}
 		}
 	}
+	return
+}
+
+func (d *mySQL) dumpTable(ctx context.Context, w io.Writer, table string) (err error) {
+	skipData := d.filter(table) == "nodata"
+	if !skipData && d.UseTableLock {
+		// MySQL refuses to flush a table locked for reading, so flush first
+		if _, err = d.FlushTableContext(ctx, table); err != nil {
+			return
+		}
+		if _, err = d.LockTableReadingContext(ctx, table); err != nil {
+			return
+		}
+		locked := time.Now()
+		// Unlock with a fresh context, so the lock is released even when ctx
+		// was canceled in the middle of the table.
+		defer func() {
+			if _, unlockErr := d.UnlockTablesContext(context.Background()); err == nil {
+				err = unlockErr
+			}
+			held := time.Since(locked)
+			d.notifyQuery(func(o QueryObserver) { o.LockReleased(table, held) })
+		}()
+	}
+	if cp := d.Checkpoint; cp != nil && cp.Table == table && cp.LastKey != "" {
+		return d.observeTable(table, 0, func() error {
+			return d.resumeTableData(ctx, w, table, cp.LastKey)
+		})
+	}
+	if d.Dialect != nil {
+		return d.dumpTableDialect(ctx, w, table, skipData)
+	}
+	if err = d.DumpCreateTableContext(ctx, w, table); err != nil {
+		return
+	}
+	if skipData {
+		d.notify(func(o Observer) { o.TableSkipped(table, "nodata") })
+		return
+	}
+	cnt, err := d.DumpTableHeaderContext(ctx, w, table)
+	if err != nil {
+		return
+	}
+	return d.observeTable(table, cnt, func() error {
+		// Data files are written even for empty tables, with their header
+		if d.Format != nil {
+			return d.DumpTableDataContext(ctx, w, table)
+		}
+		if cnt == 0 {
+			return nil
+		}
+		d.DumpTableLockWrite(w, table)
+		if err := d.DumpTableDataContext(ctx, w, table); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+		d.DumpUnlockTables(w)
+		return nil
+	})
+}
 
-	fmt.Fprintf(w, "SET FOREIGN_KEY_CHECKS = 1;\n")
+func (d *mySQL) observeTable(table string, rows uint64, fn func() error) (err error) {
+	d.notify(func(o Observer) { o.TableStarted(table, rows) })
+	err = fn()
+	d.notify(func(o Observer) { o.TableFinished(table, err) })
 	return
 }
@@ -2,10 +2,14 @@ package dumper
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"log/slog"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
@@ -237,6 +241,51 @@ func TestMySQLDumpTableData(t *testing.T) {
 	assert.Contains(t, buffer.String(), `'Closure'`)
 }
 
+func TestMySQLDumpTableDataSampledWithTableInsertRows(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ChunkSize = 100
+	dumper.SampleMap = map[string]int{"table": 3}
+	dumper.InsertRowsMap = map[string]int{"table": 1}
+	dumper.WhereMap = map[string]string{"table": "id > 0"}
+
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table` WHERE id > 0 LIMIT 3").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 3, strings.Count(buffer.String(), "INSERT INTO `table` VALUES"))
+	assert.Equal(t, "SELECT COUNT(*) FROM (SELECT 1 FROM `table` WHERE id > 0 LIMIT 3) AS `sample`",
+		dumper.countQuery("table"))
+}
+
+func TestMySQLDumpTableDataLogsStructuredFields(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	logs := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, slog.New(slog.NewJSONHandler(logs, nil)))
+
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Len(t, lines, 2)
+	var record map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "Dumped data", record["msg"])
+	assert.Equal(t, "table", record["table"])
+	assert.Equal(t, "data", record["phase"])
+	assert.Equal(t, float64(2), record["rows"])
+	assert.Contains(t, record, "duration")
+}
+
 func TestMySQLDumpTableDataHandlingErrorFromSelectAllDataFor(t *testing.T) {
 	db, mock := getDB(t)
 	buffer := bytes.NewBuffer(make([]byte, 0))
@@ -246,19 +295,72 @@ func TestMySQLDumpTableDataHandlingErrorFromSelectAllDataFor(t *testing.T) {
 	assert.Equal(t, error, dumper.DumpTableData(buffer, "table"))
 }
 
-// WIP
-// TODO Replace all tests by an integration test or create a better database/sql mock
-//func TestMySQLDump(t *testing.T) {
-//    db, mock := getDB(t)
-//    buffer := bytes.NewBuffer(make([]byte, 0))
-//    dumper := NewMySQLDumper(db, nil)
+func TestMySQLDump(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.FilterMap = map[string]string{"table2": "ignore"}
 
-//    mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
-//        sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
-//            AddRow("table1", "BASE TABLE"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("table1", "BASE TABLE").
+			AddRow("table2", "BASE TABLE"))
+	mock.ExpectQuery("SHOW CREATE TABLE `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("table1", "CREATE TABLE `table1` (`id` int)"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `table1` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Contains(t, buffer.String(), "CREATE TABLE `table1`")
+	assert.Contains(t, buffer.String(), "INSERT INTO `table1` VALUES")
+	assert.NotContains(t, buffer.String(), "table2")
+	assert.True(t, strings.HasSuffix(buffer.String(), "SET FOREIGN_KEY_CHECKS = 1;\n"))
+}
 
-//    mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table1`").WillReturnRows(
-//        sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2))
+func TestMySQLDumpReleasesLockWhenCanceled(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.UseTableLock = true
+	ctx, cancel := context.WithCancel(context.Background())
 
-//    assert.Nil(t, dumper.Dump(buffer))
-//}
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("table", "BASE TABLE"))
+	mock.ExpectExec("FLUSH TABLES `table`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("LOCK TABLES `table` READ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SHOW CREATE TABLE `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("table", "CREATE TABLE `table` (`id` int)")).
+		WillDelayFor(50 * time.Millisecond)
+	mock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	assert.NotNil(t, dumper.Dump(ctx, buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Contains(t, buffer.String(), "-- Dump aborted: ")
+	assert.NotContains(t, buffer.String(), "SET FOREIGN_KEY_CHECKS = 1;")
+}
+
+func TestMySQLFilterWithTablesAndExcludeTables(t *testing.T) {
+	dumper := NewMySQLDumper(nil, nil)
+	dumper.FilterMap = map[string]string{"customer_stats": "nodata"}
+	assert.Equal(t, "nodata", dumper.filter("Customer_Stats"))
+	assert.Equal(t, "", dumper.filter("orders"))
+
+	dumper.Tables = []string{"customer*"}
+	dumper.ExcludeTables = []string{"*_tmp"}
+	assert.Equal(t, "", dumper.filter("customer"))
+	assert.Equal(t, "nodata", dumper.filter("customer_stats"))
+	assert.Equal(t, "ignore", dumper.filter("customer_tmp"))
+	assert.Equal(t, "ignore", dumper.filter("orders"))
+}
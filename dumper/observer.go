@@ -0,0 +1,116 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"time"
+)
+
+// Observer is notified as the dump makes progress. The notifications come
+// from the goroutine running the dump, or from the workers of Copy, one at a
+// time. Workers copy several tables at once, so the notifications of
+// different tables may interleave: use the table argument to tell them apart.
+type Observer interface {
+	// DumpStarted receives the tables whose data will be dumped, with the
+	// row counts estimated by MySQL
+	DumpStarted(estimatedRows map[string]uint64)
+	// TableSkipped is called for tables whose data is not dumped, because of
+	// the filter ("ignore" or "nodata") configured for them
+	TableSkipped(table, filter string)
+	// TableStarted is called before dumping the data of a table, with its
+	// exact row count, or zero if unknown
+	TableStarted(table string, rows uint64)
+	// RowsDumped is called each time rows of the table are written out
+	RowsDumped(table string, rows, bytes uint64)
+	// TableFinished is called after dumping the data of a table
+	TableFinished(table string, err error)
+	// DumpFinished is called once the dump is over
+	DumpFinished(err error)
+}
+
+// QueryObserver is an optional interface of Observers, also notified of the
+// duration of the queries reading the data, and of how long tables were kept
+// locked.
+type QueryObserver interface {
+	// QueryDone is called after each query of the given kind: "row_count",
+	// "select_data" or "select_chunk"
+	QueryDone(kind string, duration time.Duration, err error)
+	// LockReleased is called after unlocking a table
+	LockReleased(table string, held time.Duration)
+}
+
+func (d *mySQL) notifyQuery(fn func(o QueryObserver)) {
+	for _, o := range d.Observers {
+		if qo, ok := o.(QueryObserver); ok {
+			fn(qo)
+		}
+	}
+}
+
+func (d *mySQL) queryDone(kind string, started time.Time, err error) {
+	duration := time.Since(started)
+	d.notifyQuery(func(o QueryObserver) { o.QueryDone(kind, duration, err) })
+}
+
+func (d *mySQL) notify(fn func(o Observer)) {
+	for _, o := range d.Observers {
+		fn(o)
+	}
+}
+
+// Tell the observers that rows were written to w. Rows written to a pending
+// output are only notified when, and if, the output is committed.
+func (d *mySQL) rowsDumped(w io.Writer, table string, rows, bytes uint64) {
+	if p, ok := w.(*pendingOutput); ok {
+		p.rows += rows
+		return
+	}
+	d.notify(func(o Observer) { o.RowsDumped(table, rows, bytes) })
+}
+
+// pendingOutput buffers the output of a unit of work until it succeeds
+type pendingOutput struct {
+	bytes.Buffer
+	rows uint64
+}
+
+func (p *pendingOutput) commit(d *mySQL, w io.Writer, table string) error {
+	rows, size := p.rows, uint64(p.Len())
+	if _, err := p.WriteTo(w); err != nil {
+		return err
+	}
+	if rows > 0 {
+		d.notify(func(o Observer) { o.RowsDumped(table, rows, size) })
+	}
+	return nil
+}
+
+// TableEstimate holds the row count and data size estimated by MySQL for a
+// table. For InnoDB tables they may be way off.
+type TableEstimate struct {
+	Rows       uint64
+	DataLength uint64
+}
+
+// GetTableEstimates returns the estimates of every table in the database
+func (d *mySQL) GetTableEstimates(ctx context.Context) (estimates map[string]TableEstimate, err error) {
+	estimates = make(map[string]TableEstimate)
+	var rows *sql.Rows
+	if rows, err = d.DB.QueryContext(ctx, "SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH "+
+		"FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE'"); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var tableRows, dataLength sql.NullInt64
+		if err = rows.Scan(&table, &tableRows, &dataLength); err != nil {
+			return
+		}
+		estimates[table] = TableEstimate{Rows: uint64(tableRows.Int64), DataLength: uint64(dataLength.Int64)}
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,97 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (r *recordingObserver) record(format string, args ...interface{}) {
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingObserver) DumpStarted(estimatedRows map[string]uint64) {
+	r.record("dump started %v", estimatedRows)
+}
+
+func (r *recordingObserver) TableSkipped(table, filter string) {
+	r.record("table %s skipped %s", table, filter)
+}
+
+func (r *recordingObserver) TableStarted(table string, rows uint64) {
+	r.record("table %s started %d", table, rows)
+}
+
+func (r *recordingObserver) RowsDumped(table string, rows, bytes uint64) {
+	r.record("table %s rows %d", table, rows)
+}
+
+func (r *recordingObserver) TableFinished(table string, err error) {
+	r.record("table %s finished %v", table, err)
+}
+
+func (r *recordingObserver) DumpFinished(err error) {
+	r.record("dump finished %v", err)
+}
+
+func (r *recordingObserver) QueryDone(kind string, duration time.Duration, err error) {
+	r.record("query %s %v", kind, err)
+}
+
+func (r *recordingObserver) LockReleased(table string, held time.Duration) {
+	r.record("table %s unlocked", table)
+}
+
+func TestMySQLDumpNotifiesQueryObservers(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	observer := &recordingObserver{}
+	dumper := NewMySQLDumper(db, nil)
+	dumper.UseTableLock = true
+	dumper.Observers = []Observer{observer}
+	dumper.FilterMap = map[string]string{"table2": "ignore"}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("table1", "BASE TABLE").
+			AddRow("table2", "BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH FROM information_schema.TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH"}).
+			AddRow("table1", 3, 16384).
+			AddRow("table2", 9, 16384))
+	mock.ExpectExec("FLUSH TABLES `table1`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("LOCK TABLES `table1` READ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SHOW CREATE TABLE `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("table1", "CREATE TABLE `table1` (`id` int)"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `table1` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []string{
+		"table table2 skipped ignore",
+		"dump started map[table1:3]",
+		"query row_count <nil>",
+		"table table1 started 1",
+		"query select_data <nil>",
+		"table table1 rows 1",
+		"table table1 finished <nil>",
+		"table table1 unlocked",
+		"dump finished <nil>",
+	}, observer.events)
+}
@@ -0,0 +1,299 @@
+package dumper
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// Parquet writes a Parquet file per table, with the MySQL column types mapped
+// to Parquet logical types. Integers and floating point numbers keep their
+// types, DECIMAL stays DECIMAL, DATE is DATE, DATETIME and TIMESTAMP are
+// TIMESTAMP in microseconds, taken as UTC, binary columns are raw bytes and
+// everything else is a UTF-8 string. All columns are optional, with NULL as
+// null.
+type Parquet struct {
+	// RowGroupSize is the size of the row groups in bytes, counted as read
+	// from MySQL
+	RowGroupSize int64
+	// Compression is uncompressed, snappy or gzip
+	Compression string
+}
+
+// NewParquet returns the Parquet format, with 128 MB row groups compressed
+// with snappy
+func NewParquet() *Parquet {
+	return &Parquet{RowGroupSize: 128 * 1024 * 1024, Compression: "snappy"}
+}
+
+// Extension is .parquet
+func (f *Parquet) Extension() string {
+	return ".parquet"
+}
+
+// parquetCodecs are the compressions supported
+var parquetCodecs = map[string]compress.Codec{
+	"uncompressed": &parquet.Uncompressed,
+	"snappy":       &parquet.Snappy,
+	"gzip":         &parquet.Gzip,
+}
+
+// CheckCompression returns an error if the compression isn't supported
+func (f *Parquet) CheckCompression() error {
+	if _, ok := parquetCodecs[strings.ToLower(f.Compression)]; !ok {
+		return errors.New("Invalid Parquet compression, expected uncompressed, snappy or gzip: " + f.Compression)
+	}
+	return nil
+}
+
+// NewRowWriter starts the Parquet file. Rows are kept in memory until their
+// row group is complete.
+func (f *Parquet) NewRowWriter(w io.Writer, columns []Column) (RowWriter, error) {
+	if err := f.CheckCompression(); err != nil {
+		return nil, err
+	}
+	pw := &parquetWriter{rowGroupSize: f.RowGroupSize, columns: make([]*parquetColumn, len(columns))}
+	fields := make(parquetGroup, len(columns))
+	for i, column := range columns {
+		pw.columns[i] = newParquetColumn(column)
+		fields[i] = &parquetField{Node: parquet.Optional(pw.columns[i].node), name: column.Name}
+	}
+	pw.w = parquet.NewWriter(w, parquet.NewSchema("schema", fields),
+		parquet.Compression(parquetCodecs[strings.ToLower(f.Compression)]))
+	return pw, nil
+}
+
+// parquetGroup is the root of the schema, with the columns in the order of
+// the table, as parquet.Group sorts them by name
+type parquetGroup []parquet.Field
+
+func (g parquetGroup) ID() int                     { return 0 }
+func (g parquetGroup) String() string              { return "schema" }
+func (g parquetGroup) Type() parquet.Type          { return parquet.Group{}.Type() }
+func (g parquetGroup) Optional() bool              { return false }
+func (g parquetGroup) Repeated() bool              { return false }
+func (g parquetGroup) Required() bool              { return true }
+func (g parquetGroup) Leaf() bool                  { return false }
+func (g parquetGroup) Fields() []parquet.Field     { return g }
+func (g parquetGroup) Encoding() encoding.Encoding { return nil }
+func (g parquetGroup) Compression() compress.Codec { return nil }
+func (g parquetGroup) GoType() reflect.Type        { return reflect.TypeOf(map[string]interface{}{}) }
+
+type parquetField struct {
+	parquet.Node
+	name string
+}
+
+func (f *parquetField) Name() string { return f.name }
+func (f *parquetField) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
+
+// parquetColumn maps a MySQL column to a Parquet one
+type parquetColumn struct {
+	Column
+	node parquet.Node
+	// value converts a MySQL value to its Parquet value
+	value func(value []byte) (parquet.Value, error)
+	// zeroDates, like 0000-00-00, are written as NULL
+	zeroDates bool
+}
+
+// newParquetColumn maps the type of the column. DataType is the type name of
+// the MySQL driver, like unsigned int.
+func newParquetColumn(column Column) *parquetColumn {
+	c := &parquetColumn{Column: column}
+	switch column.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "year",
+		"unsigned tinyint", "unsigned smallint", "unsigned mediumint":
+		c.node = parquet.Int(32)
+		c.value = func(value []byte) (parquet.Value, error) {
+			v, err := strconv.ParseInt(string(value), 10, 32)
+			return parquet.Int32Value(int32(v)), err
+		}
+	case "bigint", "unsigned int":
+		c.node = parquet.Int(64)
+		c.value = func(value []byte) (parquet.Value, error) {
+			v, err := strconv.ParseInt(string(value), 10, 64)
+			return parquet.Int64Value(v), err
+		}
+	case "unsigned bigint":
+		c.node = parquet.Uint(64)
+		c.value = func(value []byte) (parquet.Value, error) {
+			v, err := strconv.ParseUint(string(value), 10, 64)
+			return parquet.Int64Value(int64(v)), err
+		}
+	case "float":
+		c.node = parquet.Leaf(parquet.FloatType)
+		c.value = func(value []byte) (parquet.Value, error) {
+			v, err := strconv.ParseFloat(string(value), 32)
+			return parquet.FloatValue(float32(v)), err
+		}
+	case "double":
+		c.node = parquet.Leaf(parquet.DoubleType)
+		c.value = func(value []byte) (parquet.Value, error) {
+			v, err := strconv.ParseFloat(string(value), 64)
+			return parquet.DoubleValue(v), err
+		}
+	case "decimal":
+		if column.Precision <= 0 {
+			break
+		}
+		if column.Precision <= 18 {
+			c.node = parquet.Decimal(column.Scale, column.Precision, parquet.Int64Type)
+			c.value = func(value []byte) (parquet.Value, error) {
+				v, err := strconv.ParseInt(unscaledDecimal(string(value), column.Scale), 10, 64)
+				return parquet.Int64Value(v), err
+			}
+			break
+		}
+		// Wider decimals are fixed length byte arrays, which all readers take
+		length := decimalLength(column.Precision)
+		c.node = parquet.Decimal(column.Scale, column.Precision, parquet.FixedLenByteArrayType(length))
+		c.value = func(value []byte) (parquet.Value, error) {
+			v, ok := new(big.Int).SetString(unscaledDecimal(string(value), column.Scale), 10)
+			if !ok {
+				return parquet.Value{}, errors.New("Invalid decimal value: " + string(value))
+			}
+			b := twosComplement(v)
+			if len(b) > length {
+				return parquet.Value{}, errors.New("Decimal value out of range: " + string(value))
+			}
+			// Sign extended to the length of the column
+			pad := byte(0)
+			if v.Sign() < 0 {
+				pad = 0xff
+			}
+			return parquet.FixedLenByteArrayValue(append(bytes.Repeat([]byte{pad}, length-len(b)), b...)), nil
+		}
+	case "date":
+		c.node, c.zeroDates = parquet.Date(), true
+		c.value = func(value []byte) (parquet.Value, error) {
+			t, err := parseMySQLTime(value)
+			return parquet.Int32Value(int32(t.Unix() / 86400)), err
+		}
+	case "datetime", "timestamp":
+		c.node, c.zeroDates = parquet.Timestamp(parquet.Microsecond), true
+		c.value = func(value []byte) (parquet.Value, error) {
+			t, err := parseMySQLTime(value)
+			return parquet.Int64Value(t.UnixMicro()), err
+		}
+	}
+	if c.node == nil && binaryTypes[column.DataType] {
+		c.node = parquet.Leaf(parquet.ByteArrayType)
+	}
+	if c.node == nil {
+		c.node = parquet.String()
+	}
+	if c.value == nil {
+		c.value = func(value []byte) (parquet.Value, error) {
+			return parquet.ByteArrayValue(value), nil
+		}
+	}
+	return c
+}
+
+// unscaledDecimal returns the digits of a decimal with the given scale, like
+// -1250 for -12.5 with scale 2
+func unscaledDecimal(value string, scale int) string {
+	integer, fraction := value, ""
+	if i := strings.IndexByte(value, '.'); i >= 0 {
+		integer, fraction = value[:i], value[i+1:]
+	}
+	if len(fraction) > scale {
+		fraction = fraction[:scale]
+	}
+	return integer + fraction + strings.Repeat("0", scale-len(fraction))
+}
+
+// decimalLength returns the bytes needed by the two's complement of decimals
+// of the given precision
+func decimalLength(precision int) int {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)
+	n := 1
+	for new(big.Int).Lsh(big.NewInt(1), uint(8*n-1)).Cmp(max) < 0 {
+		n++
+	}
+	return n
+}
+
+// twosComplement returns the big-endian two's complement of v, in as few
+// bytes as possible
+func twosComplement(v *big.Int) []byte {
+	if v.Sign() >= 0 {
+		b := v.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// The complement of -v-1 has the same bits as v
+	b := new(big.Int).Not(v).Bytes()
+	for i := range b {
+		b[i] = ^b[i]
+	}
+	if len(b) == 0 || b[0]&0x80 == 0 {
+		b = append([]byte{0xff}, b...)
+	}
+	return b
+}
+
+// parseMySQLTime parses dates and datetimes, with optional fractional seconds
+func parseMySQLTime(value []byte) (time.Time, error) {
+	s := string(value)
+	layout := "2006-01-02"
+	if len(s) > len(layout) {
+		layout = "2006-01-02 15:04:05.999999999"
+	}
+	return time.Parse(layout, s)
+}
+
+type parquetWriter struct {
+	w            *parquet.Writer
+	columns      []*parquetColumn
+	row          parquet.Row
+	rowGroupSize int64
+	// size of the values of the row group
+	size int64
+}
+
+// WriteRow adds the row to the row group, written once it's full
+func (pw *parquetWriter) WriteRow(values []*sql.RawBytes) error {
+	pw.row = pw.row[:0]
+	for i, value := range values {
+		c := pw.columns[i]
+		if value == nil || c.zeroDates && bytes.HasPrefix(*value, []byte("0000-00-00")) {
+			pw.row = append(pw.row, parquet.NullValue().Level(0, 0, i))
+			continue
+		}
+		v, err := c.value(*value)
+		if err != nil {
+			return errors.New("Invalid value of column " + c.Name + ": " + err.Error())
+		}
+		pw.row = append(pw.row, v.Level(0, 1, i))
+		pw.size += int64(len(*value))
+	}
+	if _, err := pw.w.WriteRows([]parquet.Row{pw.row}); err != nil {
+		return err
+	}
+	if pw.rowGroupSize > 0 && pw.size >= pw.rowGroupSize {
+		pw.size = 0
+		return pw.w.Flush()
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer
+func (pw *parquetWriter) Close() error {
+	return pw.w.Close()
+}
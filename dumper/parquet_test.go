@@ -0,0 +1,164 @@
+package dumper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	parquetformat "github.com/parquet-go/parquet-go/format"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParquetFile(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{
+		{Name: "id", DataType: "int"},
+		{Name: "price", DataType: "decimal", Precision: 10, Scale: 2},
+		{Name: "created_at", DataType: "datetime"},
+	}
+	format := NewParquet()
+	format.Compression = "uncompressed"
+	rw, err := format.NewRowWriter(buffer, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "9.90", "2024-01-31 10:20:30")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", nil, "0000-00-00 00:00:00")))
+	assert.Nil(t, rw.Close())
+
+	data := buffer.Bytes()
+	assert.Equal(t, "PAR1", string(data[:4]))
+	assert.Equal(t, "PAR1", string(data[len(data)-4:]))
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	metadata := data[len(data)-8-footer : len(data)-8]
+	assert.Contains(t, string(metadata), "created_at")
+
+	// Both rows fit in the default row group
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), file.NumRows())
+	assert.Len(t, file.RowGroups(), 1)
+}
+
+// TestParquetRoundTrip reads the file back with another implementation of
+// Parquet
+func TestParquetRoundTrip(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{
+		{Name: "id", DataType: "int"},
+		{Name: "counter", DataType: "unsigned bigint"},
+		{Name: "price", DataType: "decimal", Precision: 10, Scale: 2},
+		{Name: "total", DataType: "decimal", Precision: 30, Scale: 2},
+		{Name: "ratio", DataType: "double"},
+		{Name: "day", DataType: "date"},
+		{Name: "created_at", DataType: "datetime"},
+		{Name: "name", DataType: "varchar"},
+		{Name: "data", DataType: "blob"},
+	}
+	format := NewParquet()
+	// A row group for each row
+	format.RowGroupSize = 1
+	rw, err := format.NewRowWriter(buffer, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", "18446744073709551615", "9.90", "-12345678901234567890.25", "0.5",
+		"2024-01-31", "2024-01-31 10:20:30.000123", "café", "\x00\xff")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", nil, nil, nil, nil, "0000-00-00", nil, nil, nil)))
+	assert.Nil(t, rw.Close())
+
+	file, err := parquet.OpenFile(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), file.NumRows())
+	assert.Len(t, file.RowGroups(), 2)
+	for _, group := range file.Metadata().RowGroups {
+		for _, chunk := range group.Columns {
+			assert.Equal(t, parquetformat.Snappy, chunk.MetaData.Codec)
+		}
+	}
+
+	logicalTypes := make(map[string]string)
+	for _, field := range file.Schema().Fields() {
+		assert.True(t, field.Optional(), field.Name())
+		logicalTypes[field.Name()] = field.Type().String()
+	}
+	assert.Equal(t, map[string]string{
+		"id":         "INT(32,true)",
+		"counter":    "INT(64,false)",
+		"price":      "DECIMAL(10,2)",
+		"total":      "DECIMAL(30,2)",
+		"ratio":      "DOUBLE",
+		"day":        "DATE",
+		"created_at": "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)",
+		"name":       "STRING",
+		"data":       "BYTE_ARRAY",
+	}, logicalTypes)
+
+	var rows []parquet.Row
+	for _, group := range file.RowGroups() {
+		groupRows := group.Rows()
+		read := make([]parquet.Row, 2)
+		n, _ := groupRows.ReadRows(read)
+		assert.Equal(t, 1, n)
+		// Values point into the pages, released on Close
+		rows = append(rows, read[0].Clone())
+		assert.Nil(t, groupRows.Close())
+	}
+	assert.Len(t, rows, 2)
+
+	first := rows[0]
+	assert.Equal(t, int32(1), first[0].Int32())
+	assert.Equal(t, uint64(18446744073709551615), first[1].Uint64())
+	assert.Equal(t, int64(990), first[2].Int64())
+	total, _ := new(big.Int).SetString("-1234567890123456789025", 10)
+	assert.Equal(t, append(bytes.Repeat([]byte{0xff}, 4), twosComplement(total)...), first[3].ByteArray())
+	assert.Equal(t, 0.5, first[4].Double())
+	assert.Equal(t, int32(time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC).Unix()/86400), first[5].Int32())
+	assert.Equal(t, time.Date(2024, 1, 31, 10, 20, 30, 123000, time.UTC).UnixMicro(), first[6].Int64())
+	assert.Equal(t, "café", string(first[7].ByteArray()))
+	assert.Equal(t, []byte{0, 0xff}, first[8].ByteArray())
+
+	second := rows[1]
+	assert.Equal(t, int32(2), second[0].Int32())
+	for i := 1; i < len(columns); i++ {
+		assert.True(t, second[i].IsNull(), columns[i].Name)
+	}
+}
+
+func TestParquetInvalidValue(t *testing.T) {
+	rw, err := NewParquet().NewRowWriter(bytes.NewBuffer(nil), []Column{{Name: "id", DataType: "int"}})
+	assert.Nil(t, err)
+	assert.EqualError(t, rw.WriteRow(rawBytes("one")),
+		`Invalid value of column id: strconv.ParseInt: parsing "one": invalid syntax`)
+}
+
+func TestParquetInvalidCompression(t *testing.T) {
+	format := NewParquet()
+	format.Compression = "lzo"
+	assert.NotNil(t, format.CheckCompression())
+}
+
+func TestUnscaledDecimal(t *testing.T) {
+	assert.Equal(t, "-1250", unscaledDecimal("-12.5", 2))
+	assert.Equal(t, "1200", unscaledDecimal("12", 2))
+	assert.Equal(t, "12", unscaledDecimal("12.345", 0))
+}
+
+func TestDecimalLength(t *testing.T) {
+	assert.Equal(t, 1, decimalLength(2))
+	assert.Equal(t, 8, decimalLength(18))
+	assert.Equal(t, 13, decimalLength(30))
+	assert.Equal(t, 28, decimalLength(65))
+}
+
+func TestTwosComplement(t *testing.T) {
+	for v, expected := range map[int64][]byte{
+		0:    {0x00},
+		127:  {0x7f},
+		128:  {0x00, 0x80},
+		-1:   {0xff},
+		-128: {0x80},
+		-129: {0xff, 0x7f},
+	} {
+		assert.Equal(t, expected, twosComplement(big.NewInt(v)), "%d", v)
+	}
+}
@@ -0,0 +1,64 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Plan writes to w what Dump would do with each table: the filter applied,
+// the queries used, the lock strategy and the size estimated by MySQL. Only
+// metadata is queried, no table data is read.
+func (d *mySQL) Plan(ctx context.Context, w io.Writer) (err error) {
+	tables, err := d.GetTablesContext(ctx)
+	if err != nil {
+		return
+	}
+	estimates, err := d.GetTableEstimates(ctx)
+	if err != nil {
+		return
+	}
+	columns, err := d.GetColumns(ctx)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(w, "-- Dry run of %d tables, no data was read\n", len(tables))
+	for _, table := range tables {
+		filter := d.filter(table)
+		fmt.Fprintf(w, "\nTable `%s`\n", table)
+		if filter == "ignore" {
+			fmt.Fprintf(w, "  Action:    ignored\n")
+			continue
+		}
+		if filter == "nodata" {
+			fmt.Fprintf(w, "  Action:    schema only, data skipped\n")
+			continue
+		}
+		fmt.Fprintf(w, "  Action:    schema and data\n")
+		estimate := estimates[table]
+		fmt.Fprintf(w, "  Estimated: %d rows, %s\n", estimate.Rows, formatBytes(estimate.DataLength))
+		if d.UseTableLock {
+			fmt.Fprintf(w, "  Lock:      FLUSH TABLES, then LOCK TABLES READ until the data is dumped\n")
+		} else {
+			fmt.Fprintf(w, "  Lock:      none\n")
+		}
+		fmt.Fprintf(w, "  Count:     %s\n", d.countQuery(table))
+		cols := d.selectColumns(table, columnNames(columns[table]))
+		if d.Format != nil {
+			fmt.Fprintf(w, "  Output:    %s\n", d.dataFile(table))
+		} else if d.ChunkSize > 0 && d.Dialect == nil {
+			var key chunkKey
+			if key, err = d.GetChunkKey(ctx, table); err != nil {
+				return
+			}
+			if key.Name != "" {
+				fmt.Fprintf(w, "  Select:    %s\n", d.chunkQuery(table, cols, key, true))
+				fmt.Fprintf(w, "  Next:      %s\n", d.chunkQuery(table, cols, key, false))
+				continue
+			}
+		}
+		fmt.Fprintf(w, "  Select:    %s\n", d.selectQuery(table, cols))
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLPlan(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.UseTableLock = true
+	dumper.ChunkSize = 100
+	dumper.FilterMap = map[string]string{"logs": "ignore", "stats": "nodata"}
+	dumper.WhereMap = map[string]string{"customer": "id > 10"}
+	dumper.SelectMap = map[string]map[string]string{"customer": {"email": "CONCAT(id, '@fiction.tld')"}}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("customer", "BASE TABLE").
+			AddRow("logs", "BASE TABLE").
+			AddRow("stats", "BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH FROM information_schema.TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH"}).
+			AddRow("customer", 1000, 3*1024*1024))
+	mock.ExpectQuery("SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)").
+			AddRow("customer", "email", "varchar", "varchar(255)"))
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("customer").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).AddRow("id", "int", "int(11)"))
+
+	assert.Nil(t, dumper.Plan(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	plan := buffer.String()
+	assert.Contains(t, plan, "Table `logs`\n  Action:    ignored\n")
+	assert.Contains(t, plan, "Table `stats`\n  Action:    schema only, data skipped\n")
+	assert.Contains(t, plan, "  Estimated: 1000 rows, 3.0 MB\n")
+	assert.Contains(t, plan, "  Lock:      FLUSH TABLES, then LOCK TABLES READ")
+	assert.Contains(t, plan, "  Count:     SELECT COUNT(*) FROM `customer` WHERE id > 10\n")
+	assert.Contains(t, plan, "  Select:    SELECT `id`, CONCAT(id, '@fiction.tld') AS `email` FROM `customer` "+
+		"WHERE (id > 10) ORDER BY `id` LIMIT 100\n")
+	assert.Contains(t, plan, "AND `id` > CAST(? AS SIGNED) ORDER BY `id` LIMIT 100\n")
+}
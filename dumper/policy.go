@@ -0,0 +1,109 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Policy lists the columns considered sensitive. Sensitive columns must be
+// masked by a select rule, or explicitly allowed, before being dumped.
+type Policy struct {
+	// Columns are column name patterns, like *email* or tax_id
+	Columns []string
+	// Types are data types, like blob or json
+	Types []string
+	// Allow are table.column patterns of sensitive columns dumped as they are
+	Allow []string
+	// Warn only logs the violations, instead of refusing to dump
+	Warn bool
+}
+
+// Violation is a sensitive column that would be dumped without masking
+type Violation struct {
+	Table  string
+	Column string
+	Reason string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s.%s: %s", v.Table, v.Column, v.Reason)
+}
+
+// CheckPolicy returns the sensitive columns of the dumped tables that have no
+// select rule nor allow entry. Columns of ignored and nodata tables are fine.
+func (d *mySQL) CheckPolicy(ctx context.Context) (violations []Violation, err error) {
+	if d.Policy == nil {
+		return
+	}
+	schema, err := d.GetColumns(ctx)
+	if err != nil {
+		return
+	}
+	return d.policyViolations(schema), nil
+}
+
+func (d *mySQL) policyViolations(schema map[string][]Column) (violations []Violation) {
+	for _, table := range sortedKeys(schema) {
+		key := strings.ToLower(table)
+		if filter := d.filter(table); filter == "ignore" || filter == "nodata" {
+			continue
+		}
+		for _, column := range schema[table] {
+			name := strings.ToLower(column.Name)
+			if _, ok := d.SelectMap[key][name]; ok {
+				continue
+			}
+			if matchAny(d.Policy.Allow, key+"."+name) {
+				continue
+			}
+			if reason := d.Policy.sensitive(name, column.DataType); reason != "" {
+				violations = append(violations, Violation{table, column.Name, reason})
+			}
+		}
+	}
+	return
+}
+
+func (p *Policy) sensitive(name, dataType string) string {
+	for _, pattern := range p.Columns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return fmt.Sprintf("name matches %q and is not masked", pattern)
+		}
+	}
+	for _, t := range p.Types {
+		if strings.EqualFold(t, dataType) {
+			return fmt.Sprintf("type %s is not masked", dataType)
+		}
+	}
+	return ""
+}
+
+// enforcePolicy refuses to dump when the policy is violated, or just logs
+// the violations if the policy only warns
+func (d *mySQL) enforcePolicy(ctx context.Context) error {
+	violations, err := d.CheckPolicy(ctx)
+	if err != nil || len(violations) == 0 {
+		return err
+	}
+	for _, v := range violations {
+		d.Log.Warn("Sensitive column not masked", "table", v.Table, "column", v.Column,
+			"reason", v.Reason, "phase", "policy")
+	}
+	if d.Policy.Warn {
+		return nil
+	}
+	return fmt.Errorf("%d sensitive columns are not masked, add [select] rules or policy allow entries",
+		len(violations))
+}
+
+// matchAny reports whether name matches any of the case insensitive patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectPolicyColumns(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)").
+			AddRow("customer", "email", "varchar", "varchar(255)").
+			AddRow("customer", "email_verified", "tinyint", "tinyint(1)").
+			AddRow("customer", "tax_id", "varchar", "varchar(20)").
+			AddRow("customer", "photo", "blob", "blob").
+			AddRow("stats", "email", "varchar", "varchar(255)"))
+}
+
+func TestMySQLCheckPolicy(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.SelectMap = map[string]map[string]string{"customer": {"email": "'x'"}}
+	dumper.FilterMap = map[string]string{"stats": "nodata"}
+	dumper.Policy = &Policy{
+		Columns: []string{"*EMAIL*", "tax_id"},
+		Types:   []string{"blob"},
+		Allow:   []string{"customer.email_verified"},
+	}
+
+	expectPolicyColumns(mock)
+
+	violations, err := dumper.CheckPolicy(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []Violation{
+		{"customer", "tax_id", `name matches "tax_id" and is not masked`},
+		{"customer", "photo", "type blob is not masked"},
+	}, violations)
+}
+
+func TestMySQLDumpRefusesPolicyViolations(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Policy = &Policy{Columns: []string{"tax_id"}}
+
+	expectPolicyColumns(mock)
+
+	err := dumper.Dump(context.Background(), buffer)
+	assert.EqualError(t, err, "1 sensitive columns are not masked, add [select] rules or policy allow entries")
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Empty(t, buffer.String())
+}
+
+func TestMySQLDumpWarnsPolicyViolations(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Policy = &Policy{Columns: []string{"tax_id"}, Warn: true}
+
+	expectPolicyColumns(mock)
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Contains(t, buffer.String(), "SET FOREIGN_KEY_CHECKS = 1;\n")
+}
+
+func TestMySQLDumpIgnoresPolicyOnViews(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Policy = &Policy{Columns: []string{"tax_id"}}
+
+	// customer_tax is a view on tax_id, which isn't dumped
+	mock.ExpectQuery("FROM information_schema.COLUMNS JOIN information_schema.TABLES .* TABLE_TYPE = 'BASE TABLE'").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).AddRow("customer_tax", "VIEW"))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,204 @@
+package dumper
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Progress is an Observer reporting rows, bytes, rates and ETA of the dump.
+// On a terminal a status line is redrawn in place every interval; otherwise a
+// new line is printed every interval, which suits CI logs.
+type Progress struct {
+	w        io.Writer
+	terminal bool
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	estimates map[string]uint64
+	expected  uint64
+	rows      uint64
+	bytes     uint64
+	started   time.Time
+	// tables being dumped, in the order they started, as copy workers dump
+	// several at once
+	tables  []*tableProgress
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+type tableProgress struct {
+	name    string
+	rows    uint64
+	done    uint64
+	bytes   uint64
+	started time.Time
+}
+
+// NewProgress is the constructor
+func NewProgress(w io.Writer, terminal bool, interval time.Duration) *Progress {
+	return &Progress{w: w, terminal: terminal, interval: interval, now: time.Now, started: time.Now()}
+}
+
+// DumpStarted starts reporting
+func (p *Progress) DumpStarted(estimatedRows map[string]uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.estimates = estimatedRows
+	for _, rows := range estimatedRows {
+		p.expected += rows
+	}
+	p.started = p.now()
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	go p.run()
+}
+
+// TableSkipped does nothing, skipped tables don't count
+func (p *Progress) TableSkipped(table, filter string) {}
+
+// TableStarted replaces the estimated row count of the table by the exact one
+func (p *Progress) TableStarted(table string, rows uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rows == 0 {
+		rows = p.estimates[table]
+	}
+	p.expected = p.expected - p.estimates[table] + rows
+	p.tables = append(p.tables, &tableProgress{name: table, rows: rows, started: p.now()})
+}
+
+// table returns the progress of a table being dumped
+func (p *Progress) table(name string) *tableProgress {
+	for _, t := range p.tables {
+		if t.name == name {
+			return t
+		}
+	}
+	t := &tableProgress{name: name, started: p.now()}
+	p.tables = append(p.tables, t)
+	return t
+}
+
+// RowsDumped accounts the rows and bytes written
+func (p *Progress) RowsDumped(table string, rows, bytes uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rows += rows
+	p.bytes += bytes
+	t := p.table(table)
+	t.done += rows
+	t.bytes += bytes
+	if t.done > t.rows {
+		p.expected += t.done - t.rows
+		t.rows = t.done
+	}
+}
+
+// TableFinished reports the totals of the table
+func (p *Progress) TableFinished(table string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := "done"
+	if err != nil {
+		status = "failed"
+	}
+	t := p.table(table)
+	p.println(fmt.Sprintf("Table `%s` %s: %d rows, %s in %s", table, status, t.done,
+		formatBytes(t.bytes), p.now().Sub(t.started).Round(time.Millisecond)))
+	for i := range p.tables {
+		if p.tables[i] == t {
+			p.tables = append(p.tables[:i], p.tables[i+1:]...)
+			break
+		}
+	}
+}
+
+// DumpFinished stops reporting and prints the overall totals
+func (p *Progress) DumpFinished(err error) {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.stopped
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := "finished"
+	if err != nil {
+		status = "aborted"
+	}
+	p.println(fmt.Sprintf("Dump %s: %d rows, %s in %s", status, p.rows, formatBytes(p.bytes),
+		p.now().Sub(p.started).Round(time.Millisecond)))
+}
+
+func (p *Progress) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.report()
+			p.mu.Unlock()
+		}
+	}
+}
+
+// On a terminal, the status line is redrawn in place
+func (p *Progress) report() {
+	if p.terminal {
+		fmt.Fprintf(p.w, "\r\033[K%s", p.status())
+	} else {
+		fmt.Fprintln(p.w, p.status())
+	}
+}
+
+func (p *Progress) println(line string) {
+	if p.terminal {
+		fmt.Fprint(p.w, "\r\033[K")
+	}
+	fmt.Fprintln(p.w, line)
+}
+
+func (p *Progress) status() string {
+	elapsed := p.now().Sub(p.started).Seconds()
+	var rowRate, byteRate float64
+	if elapsed > 0 {
+		rowRate = float64(p.rows) / elapsed
+		byteRate = float64(p.bytes) / elapsed
+	}
+	eta := "?"
+	if rowRate > 0 && p.expected >= p.rows {
+		remaining := time.Duration(float64(p.expected-p.rows) / rowRate * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	}
+	line := fmt.Sprintf("Total %s (%d/%d rows), %s, %.0f rows/s, %s/s, ETA %s",
+		percent(p.rows, p.expected), p.rows, p.expected, formatBytes(p.bytes), rowRate,
+		formatBytes(uint64(byteRate)), eta)
+	for i := len(p.tables) - 1; i >= 0; i-- {
+		t := p.tables[i]
+		tableElapsed := p.now().Sub(t.started).Seconds()
+		var tableRate float64
+		if tableElapsed > 0 {
+			tableRate = float64(t.done) / tableElapsed
+		}
+		line = fmt.Sprintf("Table `%s` %s (%d/%d rows), %.0f rows/s | %s", t.name,
+			percent(t.done, t.rows), t.done, t.rows, tableRate, line)
+	}
+	return line
+}
+
+func percent(done, total uint64) string {
+	if total == 0 {
+		return "?%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(done)*100/float64(total))
+}
+
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
@@ -0,0 +1,97 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressReportsRatesAndETA(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	progress := NewProgress(buffer, false, time.Hour)
+	now := time.Unix(0, 0)
+	progress.now = func() time.Time { return now }
+
+	progress.DumpStarted(map[string]uint64{"table1": 100, "table2": 300})
+	progress.TableStarted("table1", 200)
+	now = now.Add(10 * time.Second)
+	progress.RowsDumped("table1", 100, 2*1024*1024)
+	progress.report()
+
+	status := buffer.String()
+	assert.Contains(t, status, "Table `table1` 50.0% (100/200 rows), 10 rows/s")
+	assert.Contains(t, status, "Total 20.0% (100/500 rows), 2.0 MB, 10 rows/s, 0.2 MB/s, ETA 40s\n")
+
+	progress.TableFinished("table1", nil)
+	progress.DumpFinished(nil)
+	assert.Contains(t, buffer.String(), "Table `table1` done: 100 rows, 2.0 MB in 10s\n")
+	assert.Contains(t, buffer.String(), "Dump finished: 100 rows, 2.0 MB in 10s\n")
+}
+
+func TestProgressTracksInterleavedTables(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	progress := NewProgress(buffer, false, time.Hour)
+	now := time.Unix(0, 0)
+	progress.now = func() time.Time { return now }
+
+	progress.DumpStarted(map[string]uint64{"table1": 100, "table2": 100})
+	progress.TableStarted("table1", 100)
+	progress.TableStarted("table2", 100)
+	now = now.Add(10 * time.Second)
+	progress.RowsDumped("table1", 50, 1024*1024)
+	progress.RowsDumped("table2", 20, 1024)
+	progress.report()
+	assert.Contains(t, buffer.String(), "Table `table1` 50.0% (50/100 rows), 5 rows/s | Table `table2` 20.0% (20/100 rows), 2 rows/s | Total")
+
+	progress.TableFinished("table1", nil)
+	assert.Contains(t, buffer.String(), "Table `table1` done: 50 rows, 1.0 MB in 10s\n")
+	buffer.Reset()
+	progress.report()
+	assert.NotContains(t, buffer.String(), "table1")
+	assert.Contains(t, buffer.String(), "Table `table2` 20.0% (20/100 rows)")
+}
+
+func TestProgressRedrawsStatusLineOnTerminal(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	progress := NewProgress(buffer, true, time.Hour)
+	progress.DumpStarted(map[string]uint64{"table": 10})
+	progress.report()
+	progress.report()
+	progress.DumpFinished(nil)
+	assert.Equal(t, 3, strings.Count(buffer.String(), "\r\033[K"))
+	assert.Equal(t, 1, strings.Count(buffer.String(), "\n"))
+}
+
+func TestMySQLDumpNotifiesObservers(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	progress := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Observers = []Observer{NewProgress(progress, false, time.Hour)}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("table", "BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH FROM information_schema.TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH"}).
+			AddRow("table", 5, 16384))
+	mock.ExpectQuery("SHOW CREATE TABLE `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("table", "CREATE TABLE `table` (`id` int)"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Contains(t, progress.String(), "Table `table` done: 2 rows")
+	assert.Contains(t, progress.String(), "Dump finished: 2 rows")
+}
@@ -0,0 +1,121 @@
+package dumper
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Report is an Observer recording what the dump actually produced, to be
+// saved as JSON for auditing.
+type Report struct {
+	ServerVersion string         `json:"server_version"`
+	ConfigHash    string         `json:"config_hash,omitempty"`
+	StartedAt     time.Time      `json:"started_at"`
+	FinishedAt    time.Time      `json:"finished_at"`
+	Error         string         `json:"error,omitempty"`
+	Tables        []*TableReport `json:"tables"`
+
+	dumper *mySQL
+}
+
+// TableReport records what was done with a table
+type TableReport struct {
+	Name             string            `json:"name"`
+	Filter           string            `json:"filter,omitempty"`
+	Where            string            `json:"where,omitempty"`
+	RewrittenColumns map[string]string `json:"rewritten_columns,omitempty"`
+	RowsExpected     uint64            `json:"rows_expected"`
+	RowsWritten      uint64            `json:"rows_written"`
+	BytesWritten     uint64            `json:"bytes_written"`
+	DurationSeconds  float64           `json:"duration_seconds"`
+	Error            string            `json:"error,omitempty"`
+
+	started time.Time
+}
+
+// NewReport returns a Report of the dumps made by d
+func (d *mySQL) NewReport(ctx context.Context) (*Report, error) {
+	r := &Report{dumper: d, Tables: make([]*TableReport, 0)}
+	err := d.DB.QueryRowContext(ctx, "SELECT VERSION()").Scan(&r.ServerVersion)
+	return r, err
+}
+
+// WriteFile saves the report as JSON to path
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func (r *Report) addTable(table, filter string) *TableReport {
+	key := strings.ToLower(table)
+	t := &TableReport{
+		Name:             table,
+		Filter:           filter,
+		Where:            r.dumper.WhereMap[key],
+		RewrittenColumns: r.dumper.SelectMap[key],
+	}
+	r.Tables = append(r.Tables, t)
+	return t
+}
+
+// table returns the report of a table. Copy workers dump several tables at
+// once, so their notifications interleave.
+func (r *Report) table(name string) *TableReport {
+	for i := len(r.Tables) - 1; i >= 0; i-- {
+		if r.Tables[i].Name == name {
+			return r.Tables[i]
+		}
+	}
+	return r.addTable(name, "")
+}
+
+// DumpStarted records the start time
+func (r *Report) DumpStarted(estimatedRows map[string]uint64) {
+	r.StartedAt = time.Now()
+}
+
+// TableSkipped records the filter of the table
+func (r *Report) TableSkipped(table, filter string) {
+	t := r.addTable(table, filter)
+	t.Where, t.RewrittenColumns = "", nil
+}
+
+// TableStarted records the expected rows of the table
+func (r *Report) TableStarted(table string, rows uint64) {
+	t := r.addTable(table, "")
+	t.RowsExpected = rows
+	t.started = time.Now()
+}
+
+// RowsDumped accounts the rows and bytes written
+func (r *Report) RowsDumped(table string, rows, bytes uint64) {
+	t := r.table(table)
+	t.RowsWritten += rows
+	t.BytesWritten += bytes
+}
+
+// TableFinished records the duration and error of the table
+func (r *Report) TableFinished(table string, err error) {
+	t := r.table(table)
+	t.DurationSeconds = time.Since(t.started).Seconds()
+	if err != nil {
+		t.Error = err.Error()
+	}
+}
+
+// DumpFinished records the end time and error of the dump
+func (r *Report) DumpFinished(err error) {
+	r.FinishedAt = time.Now()
+	if r.StartedAt.IsZero() {
+		r.StartedAt = r.FinishedAt
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
@@ -0,0 +1,71 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLDumpReport(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.FilterMap = map[string]string{"skipped": "ignore", "empty": "nodata"}
+	dumper.WhereMap = map[string]string{"table": "id > 1"}
+	dumper.SelectMap = map[string]map[string]string{"table": {"name": "'x'"}}
+
+	mock.ExpectQuery("SELECT VERSION\\(\\)").WillReturnRows(
+		sqlmock.NewRows([]string{"VERSION()"}).AddRow("5.7.30-log"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("skipped", "BASE TABLE").
+			AddRow("empty", "BASE TABLE").
+			AddRow("table", "BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH FROM information_schema.TABLES").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_ROWS", "DATA_LENGTH"}))
+	mock.ExpectQuery("SHOW CREATE TABLE `empty`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("empty", "CREATE TABLE `empty` (`id` int)"))
+	mock.ExpectQuery("SHOW CREATE TABLE `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).AddRow("table", "CREATE TABLE `table` (`id` int)"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table` WHERE id > 1").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a"))
+	mock.ExpectQuery("SELECT `id`, 'x' AS `name` FROM `table` WHERE id > 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "x").AddRow(3, "x"))
+
+	report, err := dumper.NewReport(context.Background())
+	assert.Nil(t, err)
+	report.ConfigHash = "hash"
+	dumper.Observers = []Observer{report}
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	assert.Nil(t, report.WriteFile(path))
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	var loaded Report
+	assert.Nil(t, json.Unmarshal(data, &loaded))
+
+	assert.Equal(t, "5.7.30-log", loaded.ServerVersion)
+	assert.Equal(t, "hash", loaded.ConfigHash)
+	assert.False(t, loaded.FinishedAt.Before(loaded.StartedAt))
+	assert.Len(t, loaded.Tables, 3)
+	assert.Equal(t, "ignore", loaded.Tables[0].Filter)
+	assert.Equal(t, "nodata", loaded.Tables[1].Filter)
+	table := loaded.Tables[2]
+	assert.Equal(t, "table", table.Name)
+	assert.Equal(t, "id > 1", table.Where)
+	assert.Equal(t, map[string]string{"name": "'x'"}, table.RewrittenColumns)
+	assert.Equal(t, uint64(2), table.RowsExpected)
+	assert.Equal(t, uint64(2), table.RowsWritten)
+	assert.NotZero(t, table.BytesWritten)
+	assert.Empty(t, table.Error)
+}
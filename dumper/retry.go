@@ -0,0 +1,84 @@
+package dumper
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DefaultRetryableErrors are the MySQL error numbers worth retrying: lock wait
+// timeout, deadlock, server has gone away and lost connection.
+var DefaultRetryableErrors = []uint16{1205, 1213, 2006, 2013}
+
+// RetryPolicy tells how units of work failing with transient errors (a row
+// count or a chunk of a table) are retried. Units are tried at most
+// MaxAttempts times, waiting InitialBackoff before the first retry and
+// doubling the wait up to MaxBackoff after each one. For tables not dumped in
+// chunks only the query is retried, and their rows are read in a single
+// attempt, as retrying them would mean buffering the whole table.
+type RetryPolicy struct {
+	MaxAttempts     int
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	RetryableErrors []uint16
+}
+
+// IsRetryable tells if err is transient according to the policy. Broken
+// connections are always considered transient.
+func (p RetryPolicy) IsRetryable(err error) bool {
+	if errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	for _, number := range p.RetryableErrors {
+		if mysqlErr.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *mySQL) retry(ctx context.Context, unit string, fn func() error) (err error) {
+	backoff := d.Retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= d.Retry.MaxAttempts || !d.Retry.IsRetryable(err) || ctx.Err() != nil {
+			return
+		}
+		d.Log.Warn("Retrying after transient error", "unit", unit, "backoff", backoff,
+			"attempt", attempt+1, "max_attempts", d.Retry.MaxAttempts, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; d.Retry.MaxBackoff > 0 && backoff > d.Retry.MaxBackoff {
+			backoff = d.Retry.MaxBackoff
+		}
+	}
+}
+
+// retryOutput is like retry, but the output of each attempt is buffered and
+// only copied to w when the attempt succeeds, so failed attempts leave no
+// partial output behind. Only use it for units of bounded size, like chunks.
+func (d *mySQL) retryOutput(ctx context.Context, w io.Writer, table, unit string, fn func(w io.Writer) error) error {
+	if d.Retry.MaxAttempts <= 1 {
+		return fn(w)
+	}
+	var pending pendingOutput
+	return d.retry(ctx, unit, func() error {
+		pending.Reset()
+		pending.rows = 0
+		if err := fn(&pending); err != nil {
+			return err
+		}
+		return pending.commit(d, w, table)
+	})
+}
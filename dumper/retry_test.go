@@ -0,0 +1,119 @@
+package dumper
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func getRetryingDumper(t *testing.T) (*mySQL, sqlmock.Sqlmock) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Retry = RetryPolicy{
+		MaxAttempts:     3,
+		InitialBackoff:  time.Millisecond,
+		RetryableErrors: DefaultRetryableErrors,
+	}
+	return dumper, mock
+}
+
+func TestRetryPolicyIsRetryable(t *testing.T) {
+	policy := RetryPolicy{RetryableErrors: []uint16{1205}}
+	assert.True(t, policy.IsRetryable(&mysql.MySQLError{Number: 1205}))
+	assert.True(t, policy.IsRetryable(mysql.ErrInvalidConn))
+	assert.False(t, policy.IsRetryable(&mysql.MySQLError{Number: 1064}))
+	assert.False(t, policy.IsRetryable(errors.New("broken")))
+}
+
+func TestMySQLGetRowCountRetriesTransientErrors(t *testing.T) {
+	dumper, mock := getRetryingDumper(t)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table`").WillReturnError(&mysql.MySQLError{Number: 1205})
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1234))
+	count, err := dumper.GetRowCount("table")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1234), count)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLGetRowCountGivesUpAfterMaxAttempts(t *testing.T) {
+	dumper, mock := getRetryingDumper(t)
+	for i := 0; i < 3; i++ {
+		mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table`").WillReturnError(mysql.ErrInvalidConn)
+	}
+	_, err := dumper.GetRowCount("table")
+	assert.Equal(t, mysql.ErrInvalidConn, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLDumpTableChunksDiscardsOutputOfFailedAttempt(t *testing.T) {
+	dumper, mock := getRetryingDumper(t)
+	dumper.ExtendedInsertRows = 1
+	dumper.ChunkSize = 2
+	buffer := bytes.NewBuffer(make([]byte, 0))
+
+	mock.ExpectQuery("SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.KEY_COLUMN_USAGE").
+		WithArgs("table").
+		WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).AddRow("id", "int", "int(11)"))
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table` ORDER BY `id` LIMIT 2").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).
+			RowError(1, &mysql.MySQLError{Number: 2013, Message: "Lost connection"}))
+	mock.ExpectQuery("SELECT `id` FROM `table` ORDER BY `id` LIMIT 2").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("SELECT `id` FROM `table` WHERE `id` > CAST\\(\\? AS SIGNED\\) ORDER BY `id` LIMIT 2").
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, strings.Count(buffer.String(), "( '1' )"))
+	assert.Equal(t, 1, strings.Count(buffer.String(), "( '2' )"))
+}
+
+func TestMySQLDumpTableDataWithoutChunksRetriesTheQuery(t *testing.T) {
+	dumper, mock := getRetryingDumper(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table`").WillReturnError(&mysql.MySQLError{Number: 2013, Message: "Lost connection"})
+	mock.ExpectQuery("SELECT `id` FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	assert.Nil(t, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, strings.Count(buffer.String(), "( '1' )"))
+}
+
+func TestMySQLDumpTableDataWithoutChunksDoesNotRetryReading(t *testing.T) {
+	dumper, mock := getRetryingDumper(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	expectedErr := &mysql.MySQLError{Number: 2013, Message: "Lost connection"}
+
+	// Rows were already written when reading fails, so it can't be retried
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).RowError(1, expectedErr))
+
+	assert.Equal(t, expectedErr, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLDumpTableDataDoesNotRetryOtherErrors(t *testing.T) {
+	dumper, mock := getRetryingDumper(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	expectedErr := &mysql.MySQLError{Number: 1064, Message: "syntax error"}
+	mock.ExpectQuery("SELECT \\* FROM `table` LIMIT 1").WillReturnError(expectedErr)
+	assert.Equal(t, expectedErr, dumper.DumpTableData(buffer, "table"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Empty(t, buffer.String())
+}
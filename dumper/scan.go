@@ -0,0 +1,263 @@
+package dumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// MinScanConfidence is the confidence below which columns aren't reported
+const MinScanConfidence = 0.3
+
+// Finding is a column that looks like personal data
+type Finding struct {
+	Table      string
+	Column     string
+	Class      string
+	Confidence float64
+	Matches    int
+	Samples    int
+	Rule       string
+}
+
+// classifier recognizes a class of personal data by column name and value
+type classifier struct {
+	class string
+	names []string
+	value func(string) bool
+	rule  string
+	// weak values, like capitalized words, are only trusted on matching names
+	weak bool
+}
+
+func matchRegexp(expr string) func(string) bool {
+	return regexp.MustCompile(expr).MatchString
+}
+
+// Classifiers are tried in order, so more specific classes come first. An IP
+// address or a national ID would also look like a phone number, for instance.
+var classifiers = []classifier{
+	{
+		class: "email",
+		names: []string{"*email*", "*e_mail*", "*mail"},
+		value: matchRegexp(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+		rule:  "CONCAT(LEFT(SHA2(`{column}`, 256), 16), '@example.com')",
+	},
+	{
+		class: "ip",
+		names: []string{"ip", "*_ip", "ip_*", "*_ip_*", "*ip_address*", "remote_addr*"},
+		value: func(s string) bool { return net.ParseIP(s) != nil },
+		rule:  "'127.0.0.1'",
+	},
+	{
+		class: "card",
+		names: []string{"*card_number*", "*cc_number*", "*credit_card*", "pan", "*_pan"},
+		value: isCardNumber,
+		rule:  "'4111111111111111'",
+	},
+	{
+		class: "national_id",
+		names: []string{"*ssn*", "*tax_id*", "*national_id*", "*passport*", "*social_security*", "*cpf*"},
+		value: matchRegexp(`^(\d{3}-\d{2}-\d{4}|\d{3}\.\d{3}\.\d{3}-\d{2})$`),
+		rule:  "LEFT(SHA2(`{column}`, 256), CHAR_LENGTH(`{column}`))",
+	},
+	{
+		class: "phone",
+		names: []string{"*phone*", "*mobile*", "*fax*", "tel", "*_tel"},
+		value: isPhone,
+		rule:  "CONCAT('555', LPAD(CRC32(`{column}`) MOD 10000000, 7, '0'))",
+	},
+	{
+		class: "name",
+		names: []string{"*first_name*", "*last_name*", "*full_name*", "*surname*", "*given_name*", "*recipient_name*"},
+		value: matchRegexp(`^\p{Lu}[\p{L}'-]+( \p{Lu}[\p{L}'-]+){0,3}$`),
+		rule:  "CONCAT('Name ', LEFT(SHA2(`{column}`, 256), 8))",
+		weak:  true,
+	},
+	{
+		class: "free_text",
+		names: []string{"*comment*", "*note", "*notes", "*message*", "*bio", "*remark*"},
+		value: func(s string) bool { return len(s) >= 30 && strings.Count(s, " ") >= 4 },
+		rule:  "'redacted'",
+		weak:  true,
+	},
+}
+
+// textTypes are the data types sampled by Scan
+var textTypes = map[string]bool{
+	"char": true, "varchar": true, "tinytext": true, "text": true, "mediumtext": true, "longtext": true,
+}
+
+// Scan samples up to sampleRows rows of each dumped table and classifies its
+// text columns as personal data, by name and by the values found. Columns
+// already rewritten by a select rule aren't scanned, nor are views, which
+// aren't dumped.
+func (d *mySQL) Scan(ctx context.Context, sampleRows int) (findings []Finding, err error) {
+	schema, err := d.GetColumns(ctx)
+	if err != nil {
+		return
+	}
+	for _, table := range sortedKeys(schema) {
+		key := strings.ToLower(table)
+		if filter := d.filter(table); filter == "ignore" || filter == "nodata" {
+			continue
+		}
+		var columns []string
+		for _, column := range schema[table] {
+			if _, ok := d.SelectMap[key][strings.ToLower(column.Name)]; !ok && textTypes[column.DataType] {
+				columns = append(columns, column.Name)
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		d.Log.Info("Scanning table", "table", table, "phase", "scan")
+		var samples [][]string
+		if samples, err = d.sampleColumns(ctx, table, columns, sampleRows); err != nil {
+			return
+		}
+		for i, column := range columns {
+			if finding, ok := classify(column, samples[i]); ok {
+				finding.Table = table
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return
+}
+
+// sampleColumns returns the non empty values of each column
+func (d *mySQL) sampleColumns(ctx context.Context, table string, columns []string, limit int) ([][]string, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = fmt.Sprintf("`%s`", column)
+	}
+	if sample := d.SampleMap[strings.ToLower(table)]; sample > 0 && sample < limit {
+		limit = sample
+	}
+	query := fmt.Sprintf("%s LIMIT %d", d.whereQuery(table, quoted), limit)
+	d.Log.Debug("Sampling table", "table", table, "phase", "scan", "query", query)
+	rows, err := d.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make([][]string, len(columns))
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if s := strings.TrimSpace(value.String); value.Valid && s != "" {
+				samples[i] = append(samples[i], s)
+			}
+		}
+	}
+	return samples, rows.Err()
+}
+
+// classify returns the most likely class of the column. A matching name
+// accounts for 40% of the confidence and the ratio of matching values for
+// the rest. Without values to check, a matching name gives 50%.
+func classify(column string, samples []string) (best Finding, ok bool) {
+	name := strings.ToLower(column)
+	for _, c := range classifiers {
+		var nameScore float64
+		for _, pattern := range c.names {
+			if matched, _ := path.Match(pattern, name); matched {
+				nameScore = 1
+				break
+			}
+		}
+		if c.weak && nameScore == 0 {
+			continue
+		}
+		matches := 0
+		for _, sample := range samples {
+			if c.value(sample) {
+				matches++
+			}
+		}
+		confidence := 0.5 * nameScore
+		if len(samples) > 0 {
+			confidence = 0.4*nameScore + 0.6*float64(matches)/float64(len(samples))
+		}
+		confidence = math.Round(confidence*100) / 100
+		if confidence >= MinScanConfidence && confidence > best.Confidence {
+			best = Finding{
+				Column:     column,
+				Class:      c.class,
+				Confidence: confidence,
+				Matches:    matches,
+				Samples:    len(samples),
+				Rule:       strings.ReplaceAll(c.rule, "{column}", column),
+			}
+			ok = true
+		}
+	}
+	return
+}
+
+func isPhone(s string) bool {
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case !strings.ContainsRune("+ ().-", r):
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// isCardNumber checks the length and the Luhn checksum of card numbers
+func isCardNumber(s string) bool {
+	var digits []int
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, int(r-'0'))
+		case r != ' ' && r != '-':
+			return false
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		digit := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if digit *= 2; digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// WriteScanConfig writes the findings as a draft [select] section, commenting
+// the class and confidence of each suggested rule
+func WriteScanConfig(w io.Writer, findings []Finding) {
+	fmt.Fprintf(w, "# Draft rules suggested by mysqlsuperdump scan. Review them before use.\n")
+	fmt.Fprintf(w, "[select]\n")
+	for _, f := range findings {
+		fmt.Fprintf(w, "# %s, confidence %.2f (%d of %d sampled values match)\n",
+			f.Class, f.Confidence, f.Matches, f.Samples)
+		fmt.Fprintf(w, "%s.%s = %s\n", strings.ToLower(f.Table), strings.ToLower(f.Column), f.Rule)
+	}
+}
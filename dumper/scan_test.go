@@ -0,0 +1,98 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	finding, ok := classify("contact", []string{"a@b.com", "c@d.org", "none"})
+	assert.True(t, ok)
+	assert.Equal(t, "email", finding.Class)
+	assert.Equal(t, 0.4, finding.Confidence)
+	assert.Equal(t, 2, finding.Matches)
+
+	finding, ok = classify("phone", []string{"+1 (555) 123-4567"})
+	assert.True(t, ok)
+	assert.Equal(t, "phone", finding.Class)
+	assert.Equal(t, 1.0, finding.Confidence)
+	assert.Equal(t, "CONCAT('555', LPAD(CRC32(`phone`) MOD 10000000, 7, '0'))", finding.Rule)
+
+	finding, ok = classify("last_ip", []string{"10.0.0.1", "::1"})
+	assert.True(t, ok)
+	assert.Equal(t, "ip", finding.Class)
+
+	finding, ok = classify("tax_id", nil)
+	assert.True(t, ok)
+	assert.Equal(t, "national_id", finding.Class)
+	assert.Equal(t, 0.5, finding.Confidence)
+
+	_, ok = classify("zip", []string{"90210"})
+	assert.False(t, ok)
+}
+
+func TestIsCardNumber(t *testing.T) {
+	assert.True(t, isCardNumber("4111 1111 1111 1111"))
+	assert.False(t, isCardNumber("4111 1111 1111 1112"))
+	assert.False(t, isCardNumber("411111"))
+}
+
+func TestMySQLScan(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.SelectMap = map[string]map[string]string{"customer": {"first_name": "'x'"}}
+	dumper.WhereMap = map[string]string{"customer": "id > 10"}
+	dumper.FilterMap = map[string]string{"logs": "nodata"}
+
+	mock.ExpectQuery("SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)").
+			AddRow("customer", "first_name", "varchar", "varchar(50)").
+			AddRow("customer", "contact", "varchar", "varchar(255)").
+			AddRow("customer", "city", "varchar", "varchar(50)").
+			AddRow("logs", "message", "text", "text"))
+	mock.ExpectQuery("SELECT `contact`, `city` FROM `customer` WHERE id > 10 LIMIT 10").
+		WillReturnRows(sqlmock.NewRows([]string{"contact", "city"}).
+			AddRow("john@example.org", "Porto Alegre").
+			AddRow("mary@example.org", nil))
+
+	findings, err := dumper.Scan(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []Finding{{
+		Table:      "customer",
+		Column:     "contact",
+		Class:      "email",
+		Confidence: 0.6,
+		Matches:    2,
+		Samples:    2,
+		Rule:       "CONCAT(LEFT(SHA2(`contact`, 256), 16), '@example.com')",
+	}}, findings)
+
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	WriteScanConfig(buffer, findings)
+	assert.Equal(t, "# Draft rules suggested by mysqlsuperdump scan. Review them before use.\n"+
+		"[select]\n"+
+		"# email, confidence 0.60 (2 of 2 sampled values match)\n"+
+		"customer.contact = CONCAT(LEFT(SHA2(`contact`, 256), 16), '@example.com')\n", buffer.String())
+}
+
+func TestMySQLScanSkipsViews(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+
+	// Only the columns of base tables are sampled, so no rules are suggested
+	// for views
+	mock.ExpectQuery("FROM information_schema.COLUMNS JOIN information_schema.TABLES .* TABLE_TYPE = 'BASE TABLE'").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)"))
+
+	findings, err := dumper.Scan(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Empty(t, findings)
+}
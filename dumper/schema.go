@@ -0,0 +1,208 @@
+package dumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Column describes a table column, as seen in information_schema
+type Column struct {
+	Name     string
+	DataType string
+	Type     string
+	// Precision and Scale of DECIMAL columns, when known
+	Precision int
+	Scale     int
+	// Only filled by GetTableSchema. Key is PRI, UNI or MUL, and Extra is
+	// like auto_increment.
+	Nullable bool
+	Default  sql.NullString
+	Key      string
+	Extra    string
+	Comment  string
+}
+
+// TableSchema is the schema of a table, for the dialects other than MySQL
+type TableSchema struct {
+	Name        string
+	Engine      string
+	Collation   string
+	Comment     string
+	Columns     []Column
+	Indexes     []Index
+	ForeignKeys []ForeignKey
+}
+
+// Index is a key of a table. The primary key is named PRIMARY, and comes
+// first. Type is the index type, like BTREE or FULLTEXT.
+type Index struct {
+	Name    string
+	Unique  bool
+	Type    string
+	Columns []string
+}
+
+// ForeignKey is a foreign key of a table, to a table of the same database.
+// OnDelete and OnUpdate are the referential actions, like CASCADE.
+type ForeignKey struct {
+	Name              string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+	OnDelete          string
+	OnUpdate          string
+}
+
+// GetTableSchema returns the columns, indexes, foreign keys and options of a
+// table
+func (d *mySQL) GetTableSchema(ctx context.Context, table string) (schema *TableSchema, err error) {
+	schema = &TableSchema{Name: table}
+	var engine, collation sql.NullString
+	if err = d.DB.QueryRowContext(ctx, "SELECT ENGINE, TABLE_COLLATION, TABLE_COMMENT "+
+		"FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table).
+		Scan(&engine, &collation, &schema.Comment); err != nil {
+		return
+	}
+	schema.Engine, schema.Collation = engine.String, collation.String
+
+	var rows *sql.Rows
+	if rows, err = d.DB.QueryContext(ctx, "SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, "+
+		"COLUMN_DEFAULT, COLUMN_KEY, EXTRA, COLUMN_COMMENT FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", table); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var column Column
+		var nullable string
+		if err = rows.Scan(&column.Name, &column.DataType, &column.Type, &nullable,
+			&column.Default, &column.Key, &column.Extra, &column.Comment); err != nil {
+			return
+		}
+		column.Nullable = nullable == "YES"
+		schema.Columns = append(schema.Columns, column)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	var keys *sql.Rows
+	if keys, err = d.DB.QueryContext(ctx, "SELECT INDEX_NAME, NON_UNIQUE, INDEX_TYPE, COLUMN_NAME "+
+		"FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? "+
+		"ORDER BY INDEX_NAME != 'PRIMARY', INDEX_NAME, SEQ_IN_INDEX", table); err != nil {
+		return
+	}
+	defer keys.Close()
+	for keys.Next() {
+		var name, indexType string
+		var column sql.NullString
+		var nonUnique bool
+		if err = keys.Scan(&name, &nonUnique, &indexType, &column); err != nil {
+			return
+		}
+		// Functional key parts have no column
+		if !column.Valid {
+			continue
+		}
+		if n := len(schema.Indexes); n == 0 || schema.Indexes[n-1].Name != name {
+			schema.Indexes = append(schema.Indexes, Index{Name: name, Unique: !nonUnique, Type: indexType})
+		}
+		index := &schema.Indexes[len(schema.Indexes)-1]
+		index.Columns = append(index.Columns, column.String)
+	}
+	if err = keys.Err(); err != nil {
+		return
+	}
+
+	var foreignKeys *sql.Rows
+	if foreignKeys, err = d.DB.QueryContext(ctx, "SELECT k.CONSTRAINT_NAME, k.COLUMN_NAME, "+
+		"k.REFERENCED_TABLE_NAME, k.REFERENCED_COLUMN_NAME, r.DELETE_RULE, r.UPDATE_RULE "+
+		"FROM information_schema.KEY_COLUMN_USAGE k JOIN information_schema.REFERENTIAL_CONSTRAINTS r "+
+		"ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.TABLE_NAME = k.TABLE_NAME "+
+		"AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME "+
+		"WHERE k.TABLE_SCHEMA = DATABASE() AND k.TABLE_NAME = ? AND k.REFERENCED_TABLE_SCHEMA = k.TABLE_SCHEMA "+
+		"ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION", table); err != nil {
+		return
+	}
+	defer foreignKeys.Close()
+	for foreignKeys.Next() {
+		var name, column, referencedTable, referencedColumn, onDelete, onUpdate string
+		if err = foreignKeys.Scan(&name, &column, &referencedTable, &referencedColumn, &onDelete, &onUpdate); err != nil {
+			return
+		}
+		if n := len(schema.ForeignKeys); n == 0 || schema.ForeignKeys[n-1].Name != name {
+			schema.ForeignKeys = append(schema.ForeignKeys, ForeignKey{
+				Name:            name,
+				ReferencedTable: referencedTable,
+				OnDelete:        onDelete,
+				OnUpdate:        onUpdate,
+			})
+		}
+		key := &schema.ForeignKeys[len(schema.ForeignKeys)-1]
+		key.Columns = append(key.Columns, column)
+		key.ReferencedColumns = append(key.ReferencedColumns, referencedColumn)
+	}
+	err = foreignKeys.Err()
+	return
+}
+
+// GetColumns returns the columns of every table in the database, in order.
+// Views are left out, as they aren't dumped.
+func (d *mySQL) GetColumns(ctx context.Context) (columns map[string][]Column, err error) {
+	columns = make(map[string][]Column)
+	var rows *sql.Rows
+	if rows, err = d.DB.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE "+
+		"FROM information_schema.COLUMNS JOIN information_schema.TABLES USING (TABLE_SCHEMA, TABLE_NAME) "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE' "+
+		"ORDER BY TABLE_NAME, ORDINAL_POSITION"); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var column Column
+		if err = rows.Scan(&table, &column.Name, &column.DataType, &column.Type); err != nil {
+			return
+		}
+		columns[table] = append(columns[table], column)
+	}
+	err = rows.Err()
+	return
+}
+
+func columnNames(columns []Column) []string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// quoteName quotes an identifier with double quotes, as standard SQL does
+func quoteName(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteName(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// foreignKeyClause returns the standard SQL constraint of a foreign key.
+// NO ACTION, the default, is left out.
+func foreignKeyClause(key ForeignKey) string {
+	clause := fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)", quoteName(key.Name),
+		quoteNames(key.Columns), quoteName(key.ReferencedTable), quoteNames(key.ReferencedColumns))
+	if key.OnDelete != "" && key.OnDelete != "NO ACTION" {
+		clause += " ON DELETE " + key.OnDelete
+	}
+	if key.OnUpdate != "" && key.OnUpdate != "NO ACTION" {
+		clause += " ON UPDATE " + key.OnUpdate
+	}
+	return clause
+}
@@ -0,0 +1,566 @@
+package dumper
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// pgSQL dumps the current schema of a PostgreSQL 12 or later database as a
+// psql script, reading the schema from pg_catalog and the data with COPY TO.
+// Dump reads every table in the same REPEATABLE READ snapshot.
+type pgSQL struct {
+	Rules
+	DB           *sql.DB
+	Log          *slog.Logger
+	UseTableLock bool
+	Observers    []Observer
+	// conn holds the snapshot while Dump runs
+	conn *sql.Conn
+	// foreignKeys are added once every table is loaded, while Dump runs
+	foreignKeys []string
+	// copyTo runs a COPY TO STDOUT query on conn, returning the rows copied
+	copyTo func(ctx context.Context, conn *sql.Conn, w io.Writer, query string) (int64, error)
+}
+
+// NewPostgreSQLDumper is the constructor of the PostgreSQL source. The db
+// must use the pgx driver. A nil logger discards the logs.
+func NewPostgreSQLDumper(db *sql.DB, logger *slog.Logger) *pgSQL {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &pgSQL{DB: db, Log: logger, copyTo: pgxCopyTo}
+}
+
+// pgxCopyTo runs COPY TO through the pgx connection, as database/sql can't
+func pgxCopyTo(ctx context.Context, conn *sql.Conn, w io.Writer, query string) (rows int64, err error) {
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("The PostgreSQL dumper needs the pgx driver")
+		}
+		tag, err := c.Conn().PgConn().CopyTo(ctx, w, query)
+		rows = tag.RowsAffected()
+		return err
+	})
+	return
+}
+
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// db returns the connection of the snapshot while Dump runs
+func (d *pgSQL) db() queryer {
+	if d.conn != nil {
+		return d.conn
+	}
+	return d.DB
+}
+
+func (d *pgSQL) notify(fn func(o Observer)) {
+	for _, o := range d.Observers {
+		fn(o)
+	}
+}
+
+// Lock the table against schema changes, like pg_dump does, until the
+// snapshot ends. The snapshot already hides the writes. It only works while
+// Dump runs.
+func (d *pgSQL) LockTableReadingContext(ctx context.Context, table string) (sql.Result, error) {
+	d.Log.Debug("Locking table for reading", "table", table, "phase", "lock")
+	return d.db().ExecContext(ctx, fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", quoteName(table)))
+}
+
+// UnlockTablesContext does nothing, as locks are released with the snapshot
+func (d *pgSQL) UnlockTablesContext(ctx context.Context) (sql.Result, error) {
+	return driver.ResultNoRows, nil
+}
+
+// GetTablesContext lists the tables of the current schema. Partitions are
+// dumped with their partitioned table.
+func (d *pgSQL) GetTablesContext(ctx context.Context) (tables []string, err error) {
+	tables = make([]string, 0)
+	var rows *sql.Rows
+	if rows, err = d.db().QueryContext(ctx, "SELECT c.relname FROM pg_catalog.pg_class c "+
+		"JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace "+
+		"WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p') AND NOT c.relispartition "+
+		"ORDER BY c.relname"); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			return
+		}
+		tables = append(tables, table)
+	}
+	err = rows.Err()
+	return
+}
+
+// pgColumn is a column as seen in pg_catalog
+type pgColumn struct {
+	Name      string
+	Type      string
+	NotNull   bool
+	Default   sql.NullString
+	Identity  string // a for ALWAYS, d for BY DEFAULT
+	Generated string // s for STORED
+	Sequence  sql.NullString
+	Comment   sql.NullString
+}
+
+func (d *pgSQL) getColumns(ctx context.Context, table string) (columns []pgColumn, err error) {
+	var rows *sql.Rows
+	if rows, err = d.db().QueryContext(ctx, "SELECT a.attname, pg_catalog.format_type(a.atttypid, a.atttypmod), "+
+		"a.attnotnull, pg_catalog.pg_get_expr(ad.adbin, ad.adrelid), a.attidentity::text, a.attgenerated::text, "+
+		"(SELECT s.relname FROM pg_catalog.pg_depend dep JOIN pg_catalog.pg_class s ON s.oid = dep.objid "+
+		"WHERE dep.refobjid = a.attrelid AND dep.refobjsubid = a.attnum AND s.relkind = 'S' LIMIT 1), "+
+		"pg_catalog.col_description(a.attrelid, a.attnum) "+
+		"FROM pg_catalog.pg_attribute a "+
+		"LEFT JOIN pg_catalog.pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum "+
+		"WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum",
+		quoteName(table)); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c pgColumn
+		if err = rows.Scan(&c.Name, &c.Type, &c.NotNull, &c.Default, &c.Identity, &c.Generated,
+			&c.Sequence, &c.Comment); err != nil {
+			return
+		}
+		columns = append(columns, c)
+	}
+	err = rows.Err()
+	return
+}
+
+// DumpCreateTableContext writes the CREATE TABLE statement of the table, with
+// its sequences, constraints, indexes and comments. While Dump runs, foreign
+// keys are added at the end, once every table is loaded. Partitioned tables
+// are created with their partitions, which get the indexes and constraints of
+// the partitioned table, but not their own.
+func (d *pgSQL) DumpCreateTableContext(ctx context.Context, w io.Writer, table string) error {
+	d.Log.Info("Dumping structure", "table", table, "phase", "schema")
+	name := quoteName(table)
+	columns, err := d.getColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	var lines, after []string
+	for _, c := range columns {
+		line := quoteName(c.Name) + " " + c.Type
+		switch {
+		case c.Identity == "a":
+			line += " GENERATED ALWAYS AS IDENTITY"
+		case c.Identity == "d":
+			line += " GENERATED BY DEFAULT AS IDENTITY"
+		case c.Generated == "s":
+			line += " GENERATED ALWAYS AS (" + c.Default.String + ") STORED"
+		case c.Default.Valid:
+			line += " DEFAULT " + c.Default.String
+		}
+		if c.NotNull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+		// Sequences of serial columns
+		if c.Sequence.Valid && c.Identity == "" {
+			after = append(after, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s.%s;",
+				quoteName(c.Sequence.String), name, quoteName(c.Name)))
+		}
+		if c.Comment.Valid {
+			after = append(after, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s;", name, quoteName(c.Name),
+				pgString(c.Comment.String)))
+		}
+	}
+
+	var rows *sql.Rows
+	if rows, err = d.db().QueryContext(ctx, "SELECT conname, contype::text, pg_catalog.pg_get_constraintdef(oid) "+
+		"FROM pg_catalog.pg_constraint WHERE conrelid = $1::regclass AND contype IN ('p', 'u', 'c', 'x', 'f') "+
+		"ORDER BY contype, conname", name); err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var constraint, kind, def string
+		if err = rows.Scan(&constraint, &kind, &def); err != nil {
+			return err
+		}
+		if kind != "f" {
+			lines = append(lines, "CONSTRAINT "+quoteName(constraint)+" "+def)
+			continue
+		}
+		fk := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s %s;", name, quoteName(constraint), def)
+		if d.foreignKeys != nil {
+			d.foreignKeys = append(d.foreignKeys, fk)
+		} else {
+			after = append(after, fk)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// Index definitions name the table with its schema, which is dropped
+	var indexes *sql.Rows
+	if indexes, err = d.db().QueryContext(ctx, "SELECT replace(replace(pg_catalog.pg_get_indexdef(i.indexrelid), "+
+		"' ON ONLY ' || quote_ident(n.nspname) || '.', ' ON ONLY '), ' ON ' || quote_ident(n.nspname) || '.', ' ON ') "+
+		"FROM pg_catalog.pg_index i JOIN pg_catalog.pg_class c ON c.oid = i.indrelid "+
+		"JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace "+
+		"WHERE i.indrelid = $1::regclass AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_constraint con "+
+		"WHERE con.conindid = i.indexrelid AND con.conrelid = i.indrelid) ORDER BY i.indexrelid", name); err != nil {
+		return err
+	}
+	defer indexes.Close()
+	for indexes.Next() {
+		var def string
+		if err = indexes.Scan(&def); err != nil {
+			return err
+		}
+		after = append(after, def+";")
+	}
+	if err = indexes.Err(); err != nil {
+		return err
+	}
+
+	var comment, partitionKey sql.NullString
+	if err = d.db().QueryRowContext(ctx, "SELECT pg_catalog.obj_description($1::regclass, 'pg_class'), "+
+		"pg_catalog.pg_get_partkeydef($1::regclass)", name).Scan(&comment, &partitionKey); err != nil {
+		return err
+	}
+	if comment.Valid {
+		after = append(after, fmt.Sprintf("COMMENT ON TABLE %s IS %s;", name, pgString(comment.String)))
+	}
+	var partitions []string
+	if partitionKey.Valid {
+		if partitions, err = d.getPartitions(ctx, table); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(w, "\n--\n-- Structure for table %s\n--\n\n", name)
+	fmt.Fprintf(w, "DROP TABLE IF EXISTS %s CASCADE;\n", name)
+	for _, c := range columns {
+		if c.Sequence.Valid && c.Identity == "" {
+			fmt.Fprintf(w, "CREATE SEQUENCE %s;\n", quoteName(c.Sequence.String))
+		}
+	}
+	fmt.Fprintf(w, "CREATE TABLE %s (\n  %s\n)", name, strings.Join(lines, ",\n  "))
+	if partitionKey.Valid {
+		fmt.Fprintf(w, " PARTITION BY %s", partitionKey.String)
+	}
+	fmt.Fprintf(w, ";\n")
+	for _, partition := range partitions {
+		fmt.Fprintln(w, partition)
+	}
+	for _, statement := range after {
+		fmt.Fprintln(w, statement)
+	}
+	return nil
+}
+
+// getPartitions returns the statements creating the partitions of a
+// partitioned table, and of its partitions in turn
+func (d *pgSQL) getPartitions(ctx context.Context, table string) (statements []string, err error) {
+	var rows *sql.Rows
+	if rows, err = d.db().QueryContext(ctx, "SELECT c.relname, pg_catalog.pg_get_expr(c.relpartbound, c.oid), "+
+		"pg_catalog.pg_get_partkeydef(c.oid) FROM pg_catalog.pg_inherits i "+
+		"JOIN pg_catalog.pg_class c ON c.oid = i.inhrelid "+
+		"WHERE i.inhparent = $1::regclass ORDER BY c.relname", quoteName(table)); err != nil {
+		return
+	}
+	var partitions []string
+	var subpartitioned []bool
+	for rows.Next() {
+		var partition, bound string
+		var partitionKey sql.NullString
+		if err = rows.Scan(&partition, &bound, &partitionKey); err != nil {
+			rows.Close()
+			return
+		}
+		statement := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s %s", quoteName(partition), quoteName(table), bound)
+		if partitionKey.Valid {
+			statement += " PARTITION BY " + partitionKey.String
+		}
+		statements = append(statements, statement+";")
+		partitions = append(partitions, partition)
+		subpartitioned = append(subpartitioned, partitionKey.Valid)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+	// The rows are closed first, as the snapshot has a single connection
+	for i, partition := range partitions {
+		if subpartitioned[i] {
+			var more []string
+			if more, err = d.getPartitions(ctx, partition); err != nil {
+				return
+			}
+			statements = append(statements, more...)
+		}
+	}
+	return
+}
+
+// Quote the column names, replacing them by the select map expressions
+func (d *pgSQL) selectColumns(table string, columns []string) []string {
+	selected := make([]string, len(columns))
+	for i, column := range columns {
+		if replacement, ok := d.SelectMap[strings.ToLower(table)][strings.ToLower(column)]; ok {
+			selected[i] = replacement + " AS " + quoteName(column)
+		} else {
+			selected[i] = quoteName(column)
+		}
+	}
+	return selected
+}
+
+// selectQuery returns the SELECT of cols from the table, filtered by the
+// WHERE rule and sampled
+func (d *pgSQL) selectQuery(table string, cols []string) string {
+	key := strings.ToLower(table)
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), quoteName(table))
+	if where, ok := d.WhereMap[key]; ok {
+		query = fmt.Sprintf("%s WHERE %s", query, where)
+	}
+	if sample := d.SampleMap[key]; sample > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, sample)
+	}
+	return query
+}
+
+// GetRowCountContext returns the number of rows the data will have
+func (d *pgSQL) GetRowCountContext(ctx context.Context, table string) (count uint64, err error) {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS \"data\"", d.selectQuery(table, []string{"1"}))
+	d.Log.Debug("Counting rows", "table", table, "phase", "count", "query", query)
+	err = d.db().QueryRowContext(ctx, query).Scan(&count)
+	return
+}
+
+// DumpTableDataContext writes the data of the table as a COPY FROM stdin
+// block, followed by the values of its sequences
+func (d *pgSQL) DumpTableDataContext(ctx context.Context, w io.Writer, table string) (err error) {
+	conn := d.conn
+	if conn == nil {
+		if conn, err = d.DB.Conn(ctx); err != nil {
+			return
+		}
+		defer conn.Close()
+	}
+	d.Log.Info("Dumping data", "table", table, "phase", "data")
+	started := time.Now()
+	all, err := d.getColumns(ctx, table)
+	if err != nil {
+		return
+	}
+	var columns, sequences []string
+	for _, c := range all {
+		// Generated columns can't be loaded
+		if c.Generated == "" {
+			columns = append(columns, c.Name)
+		}
+		if c.Sequence.Valid {
+			sequences = append(sequences, c.Sequence.String)
+		}
+	}
+
+	query := "COPY (" + d.selectQuery(table, d.selectColumns(table, columns)) + ") TO STDOUT"
+	d.Log.Debug("Querying data", "table", table, "phase", "data", "query", query)
+	fmt.Fprintf(w, "COPY %s (%s) FROM stdin;\n", quoteName(table), quoteNames(columns))
+	counter := &countingWriter{w: w}
+	count, err := d.copyTo(ctx, conn, counter, query)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "\\.\n")
+	d.notify(func(o Observer) { o.RowsDumped(table, uint64(count), uint64(counter.n)) })
+
+	for _, sequence := range sequences {
+		var value int64
+		var called bool
+		if err = d.db().QueryRowContext(ctx, fmt.Sprintf("SELECT last_value, is_called FROM %s",
+			quoteName(sequence))).Scan(&value, &called); err != nil {
+			return
+		}
+		fmt.Fprintf(w, "SELECT pg_catalog.setval(%s, %d, %t);\n", pgString(quoteName(sequence)), value, called)
+	}
+	d.Log.Info("Dumped data", "table", table, "phase", "data", "rows", count, "duration", time.Since(started))
+	return
+}
+
+// dumpEnums writes the enum types of the current schema
+func (d *pgSQL) dumpEnums(ctx context.Context, w io.Writer) (err error) {
+	var rows *sql.Rows
+	if rows, err = d.db().QueryContext(ctx, "SELECT t.typname, "+
+		"string_agg(quote_literal(e.enumlabel), ', ' ORDER BY e.enumsortorder) "+
+		"FROM pg_catalog.pg_type t JOIN pg_catalog.pg_enum e ON e.enumtypid = t.oid "+
+		"JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace "+
+		"WHERE n.nspname = current_schema() GROUP BY t.typname ORDER BY t.typname"); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, labels string
+		if err = rows.Scan(&name, &labels); err != nil {
+			return
+		}
+		fmt.Fprintf(w, "DROP TYPE IF EXISTS %s CASCADE;\n", quoteName(name))
+		fmt.Fprintf(w, "CREATE TYPE %s AS ENUM (%s);\n", quoteName(name), labels)
+	}
+	return rows.Err()
+}
+
+// getEstimates returns the row counts estimated by PostgreSQL
+func (d *pgSQL) getEstimates(ctx context.Context) (estimates map[string]uint64, err error) {
+	estimates = make(map[string]uint64)
+	var rows *sql.Rows
+	if rows, err = d.db().QueryContext(ctx, "SELECT c.relname, GREATEST(c.reltuples, 0)::bigint "+
+		"FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace "+
+		"WHERE n.nspname = current_schema() AND c.relkind IN ('r', 'p')"); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var count uint64
+		if err = rows.Scan(&table, &count); err != nil {
+			return
+		}
+		estimates[table] = count
+	}
+	err = rows.Err()
+	return
+}
+
+// Dump writes the whole schema to w, in a single transaction, so an aborted
+// dump loads nothing. Tables are read in a REPEATABLE READ snapshot and, with
+// UseTableLock, locked against schema changes until the end. Like pg_dump,
+// the tables are all locked before the snapshot starts.
+func (d *pgSQL) Dump(ctx context.Context, w io.Writer) (err error) {
+	defer func() {
+		d.notify(func(o Observer) { o.DumpFinished(err) })
+	}()
+	if d.conn, err = d.DB.Conn(ctx); err != nil {
+		return
+	}
+	defer func() {
+		d.conn.Close()
+		d.conn = nil
+	}()
+	d.Log.Debug("Getting table list", "phase", "tables")
+	tables, err := d.GetTablesContext(ctx)
+	if err != nil {
+		return
+	}
+	var selected []string
+	for _, table := range tables {
+		if d.filter(table) == "ignore" {
+			d.notify(func(o Observer) { o.TableSkipped(table, "ignore") })
+			continue
+		}
+		selected = append(selected, table)
+	}
+	if _, err = d.conn.ExecContext(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return
+	}
+	// End the snapshot with a fresh context, even when ctx was canceled
+	defer d.conn.ExecContext(context.Background(), "ROLLBACK")
+	// The snapshot starts with the first query, not with BEGIN or LOCK
+	if d.UseTableLock && len(selected) > 0 {
+		if err = d.lockTables(ctx, selected); err != nil {
+			return
+		}
+	}
+
+	d.foreignKeys = make([]string, 0)
+	defer func() { d.foreignKeys = nil }()
+	fmt.Fprintf(w, "SET client_encoding = 'UTF8';\n")
+	fmt.Fprintf(w, "SET standard_conforming_strings = on;\n")
+	fmt.Fprintf(w, "BEGIN;\n")
+	if err = d.dumpEnums(ctx, w); err == nil {
+		err = d.dumpTables(ctx, w, selected)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "\n-- Dump aborted: %s\n", err)
+		fmt.Fprintf(w, "ROLLBACK;\n")
+		return
+	}
+	if len(d.foreignKeys) > 0 {
+		fmt.Fprintf(w, "\n--\n-- Foreign keys\n--\n\n")
+		for _, fk := range d.foreignKeys {
+			fmt.Fprintln(w, fk)
+		}
+	}
+	fmt.Fprintf(w, "COMMIT;\n")
+	return
+}
+
+// lockTables locks the tables against schema changes in a single statement,
+// until the snapshot ends. Partitions are locked with their table.
+func (d *pgSQL) lockTables(ctx context.Context, tables []string) error {
+	d.Log.Debug("Locking tables for reading", "tables", len(tables), "phase", "lock")
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = quoteName(table)
+	}
+	_, err := d.conn.ExecContext(ctx, fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", strings.Join(quoted, ", ")))
+	return err
+}
+
+func (d *pgSQL) dumpTables(ctx context.Context, w io.Writer, pending []string) (err error) {
+	if len(d.Observers) > 0 {
+		var estimates map[string]uint64
+		if estimates, err = d.getEstimates(ctx); err != nil {
+			return
+		}
+		estimatedRows := make(map[string]uint64)
+		for _, table := range pending {
+			if d.filter(table) != "nodata" {
+				estimatedRows[table] = estimates[table]
+			}
+		}
+		d.notify(func(o Observer) { o.DumpStarted(estimatedRows) })
+	}
+
+	for _, table := range pending {
+		if err = d.dumpTable(ctx, w, table); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (d *pgSQL) dumpTable(ctx context.Context, w io.Writer, table string) (err error) {
+	skipData := d.filter(table) == "nodata"
+	if err = d.DumpCreateTableContext(ctx, w, table); err != nil {
+		return
+	}
+	if skipData {
+		d.notify(func(o Observer) { o.TableSkipped(table, "nodata") })
+		return
+	}
+	count, err := d.GetRowCountContext(ctx, table)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "\n--\n-- Data for table %s -- %d rows\n--\n\n", quoteName(table), count)
+	d.notify(func(o Observer) { o.TableStarted(table, count) })
+	err = d.DumpTableDataContext(ctx, w, table)
+	d.notify(func(o Observer) { o.TableFinished(table, err) })
+	return
+}
@@ -0,0 +1,194 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// expectPgColumns expects the columns of a table with a serial id, an email
+// and a generated column
+func expectPgColumns(mock sqlmock.Sqlmock, table string) {
+	mock.ExpectQuery("SELECT a.attname, pg_catalog.format_type").WithArgs(`"` + table + `"`).WillReturnRows(
+		sqlmock.NewRows([]string{"attname", "format_type", "attnotnull", "pg_get_expr", "attidentity",
+			"attgenerated", "relname", "col_description"}).
+			AddRow("id", "integer", true, "nextval('users_id_seq'::regclass)", "", "", "users_id_seq", nil).
+			AddRow("email", "character varying(100)", false, nil, "", "", nil, "Login").
+			AddRow("domain", "text", false, "split_part(email, '@', 2)", "", "s", nil, nil))
+}
+
+// expectPgCreateTable expects the queries of DumpCreateTableContext
+func expectPgCreateTable(mock sqlmock.Sqlmock, table string) {
+	expectPgColumns(mock, table)
+	mock.ExpectQuery("SELECT conname, contype::text").WithArgs(`"` + table + `"`).WillReturnRows(
+		sqlmock.NewRows([]string{"conname", "contype", "pg_get_constraintdef"}).
+			AddRow("users_group_fkey", "f", "FOREIGN KEY (group_id) REFERENCES groups(id)").
+			AddRow("users_pkey", "p", "PRIMARY KEY (id)").
+			AddRow("users_email_key", "u", "UNIQUE (email)"))
+	mock.ExpectQuery("SELECT replace\\(replace\\(pg_catalog.pg_get_indexdef").WithArgs(`"` + table + `"`).WillReturnRows(
+		sqlmock.NewRows([]string{"replace"}).
+			AddRow("CREATE INDEX users_domain_idx ON users USING btree (domain)"))
+	mock.ExpectQuery("SELECT pg_catalog.obj_description").WithArgs(`"` + table + `"`).WillReturnRows(
+		sqlmock.NewRows([]string{"obj_description", "pg_get_partkeydef"}).AddRow("People's accounts", nil))
+}
+
+const pgCreateUsers = "\n--\n-- Structure for table \"users\"\n--\n\n" +
+	"DROP TABLE IF EXISTS \"users\" CASCADE;\n" +
+	"CREATE SEQUENCE \"users_id_seq\";\n" +
+	"CREATE TABLE \"users\" (\n" +
+	"  \"id\" integer DEFAULT nextval('users_id_seq'::regclass) NOT NULL,\n" +
+	"  \"email\" character varying(100),\n" +
+	"  \"domain\" text GENERATED ALWAYS AS (split_part(email, '@', 2)) STORED,\n" +
+	"  CONSTRAINT \"users_pkey\" PRIMARY KEY (id),\n" +
+	"  CONSTRAINT \"users_email_key\" UNIQUE (email)\n" +
+	");\n" +
+	"ALTER SEQUENCE \"users_id_seq\" OWNED BY \"users\".\"id\";\n" +
+	"COMMENT ON COLUMN \"users\".\"email\" IS 'Login';\n"
+
+func TestPostgreSQLGetTables(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewPostgreSQLDumper(db, nil)
+	mock.ExpectQuery("SELECT c.relname FROM pg_catalog.pg_class").WillReturnRows(
+		sqlmock.NewRows([]string{"relname"}).AddRow("groups").AddRow("users"))
+	tables, err := dumper.GetTablesContext(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"groups", "users"}, tables)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgreSQLDumpCreateTable(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewPostgreSQLDumper(db, nil)
+	expectPgCreateTable(mock, "users")
+
+	assert.Nil(t, dumper.DumpCreateTableContext(context.Background(), buffer, "users"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, pgCreateUsers+
+		"ALTER TABLE \"users\" ADD CONSTRAINT \"users_group_fkey\" FOREIGN KEY (group_id) REFERENCES groups(id);\n"+
+		"CREATE INDEX users_domain_idx ON users USING btree (domain);\n"+
+		"COMMENT ON TABLE \"users\" IS 'People''s accounts';\n", buffer.String())
+}
+
+func TestPostgreSQLDumpCreatePartitionedTable(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewPostgreSQLDumper(db, nil)
+
+	mock.ExpectQuery("SELECT a.attname, pg_catalog.format_type").WithArgs(`"events"`).WillReturnRows(
+		sqlmock.NewRows([]string{"attname", "format_type", "attnotnull", "pg_get_expr", "attidentity",
+			"attgenerated", "relname", "col_description"}).
+			AddRow("created_at", "date", true, nil, "", "", nil, nil))
+	mock.ExpectQuery("SELECT conname, contype::text").WithArgs(`"events"`).WillReturnRows(
+		sqlmock.NewRows([]string{"conname", "contype", "pg_get_constraintdef"}))
+	mock.ExpectQuery("SELECT replace\\(replace\\(pg_catalog.pg_get_indexdef").WithArgs(`"events"`).WillReturnRows(
+		sqlmock.NewRows([]string{"replace"}))
+	mock.ExpectQuery("SELECT pg_catalog.obj_description").WithArgs(`"events"`).WillReturnRows(
+		sqlmock.NewRows([]string{"obj_description", "pg_get_partkeydef"}).AddRow(nil, "RANGE (created_at)"))
+	mock.ExpectQuery("SELECT c.relname, pg_catalog.pg_get_expr\\(c.relpartbound").WithArgs(`"events"`).WillReturnRows(
+		sqlmock.NewRows([]string{"relname", "pg_get_expr", "pg_get_partkeydef"}).
+			AddRow("events_2024", "FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')", "LIST (created_at)").
+			AddRow("events_default", "DEFAULT", nil))
+	mock.ExpectQuery("SELECT c.relname, pg_catalog.pg_get_expr\\(c.relpartbound").WithArgs(`"events_2024"`).WillReturnRows(
+		sqlmock.NewRows([]string{"relname", "pg_get_expr", "pg_get_partkeydef"}).
+			AddRow("events_2024_01_01", "FOR VALUES IN ('2024-01-01')", nil))
+
+	assert.Nil(t, dumper.DumpCreateTableContext(context.Background(), buffer, "events"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "\n--\n-- Structure for table \"events\"\n--\n\n"+
+		"DROP TABLE IF EXISTS \"events\" CASCADE;\n"+
+		"CREATE TABLE \"events\" (\n  \"created_at\" date NOT NULL\n) PARTITION BY RANGE (created_at);\n"+
+		"CREATE TABLE \"events_2024\" PARTITION OF \"events\" "+
+		"FOR VALUES FROM ('2024-01-01') TO ('2025-01-01') PARTITION BY LIST (created_at);\n"+
+		"CREATE TABLE \"events_default\" PARTITION OF \"events\" DEFAULT;\n"+
+		"CREATE TABLE \"events_2024_01_01\" PARTITION OF \"events_2024\" FOR VALUES IN ('2024-01-01');\n",
+		buffer.String())
+}
+
+// fakeCopyTo writes the rows as COPY TO would, keeping the query
+func fakeCopyTo(query *string, rows ...string) func(context.Context, *sql.Conn, io.Writer, string) (int64, error) {
+	return func(ctx context.Context, conn *sql.Conn, w io.Writer, q string) (int64, error) {
+		*query = q
+		for _, row := range rows {
+			io.WriteString(w, row+"\n")
+		}
+		return int64(len(rows)), nil
+	}
+}
+
+func TestPostgreSQLDumpTableData(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewPostgreSQLDumper(db, nil)
+	dumper.SelectMap = map[string]map[string]string{"users": {"email": "md5(email) || '@example.com'"}}
+	dumper.WhereMap = map[string]string{"users": "id < 100"}
+	dumper.SampleMap = map[string]int{"users": 10}
+	var query string
+	dumper.copyTo = fakeCopyTo(&query, "1\tc4ca@example.com", "2\t\\N")
+
+	expectPgColumns(mock, "users")
+	mock.ExpectQuery("SELECT last_value, is_called FROM \"users_id_seq\"").WillReturnRows(
+		sqlmock.NewRows([]string{"last_value", "is_called"}).AddRow(42, true))
+
+	assert.Nil(t, dumper.DumpTableDataContext(context.Background(), buffer, "users"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "COPY (SELECT \"id\", md5(email) || '@example.com' AS \"email\" FROM \"users\" "+
+		"WHERE id < 100 LIMIT 10) TO STDOUT", query)
+	assert.Equal(t, "COPY \"users\" (\"id\", \"email\") FROM stdin;\n"+
+		"1\tc4ca@example.com\n2\t\\N\n\\.\n"+
+		"SELECT pg_catalog.setval('\"users_id_seq\"', 42, true);\n", buffer.String())
+}
+
+func TestPostgreSQLDump(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewPostgreSQLDumper(db, nil)
+	dumper.UseTableLock = true
+	dumper.FilterMap = map[string]string{"groups": "nodata", "sessions": "ignore"}
+	var query string
+	dumper.copyTo = fakeCopyTo(&query, "1\ta@b.c")
+
+	mock.ExpectQuery("SELECT c.relname FROM pg_catalog.pg_class").WillReturnRows(
+		sqlmock.NewRows([]string{"relname"}).AddRow("groups").AddRow("sessions").AddRow("users"))
+	mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("LOCK TABLE \"groups\", \"users\" IN ACCESS SHARE MODE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT t.typname").WillReturnRows(
+		sqlmock.NewRows([]string{"typname", "string_agg"}).AddRow("mood", "'sad', 'happy'"))
+	mock.ExpectQuery("SELECT a.attname").WithArgs(`"groups"`).WillReturnRows(
+		sqlmock.NewRows([]string{"attname", "format_type", "attnotnull", "pg_get_expr", "attidentity",
+			"attgenerated", "relname", "col_description"}).
+			AddRow("id", "integer", true, nil, "d", "", "groups_id_seq", nil))
+	mock.ExpectQuery("SELECT conname").WithArgs(`"groups"`).WillReturnRows(
+		sqlmock.NewRows([]string{"conname", "contype", "pg_get_constraintdef"}))
+	mock.ExpectQuery("SELECT replace").WithArgs(`"groups"`).WillReturnRows(sqlmock.NewRows([]string{"replace"}))
+	mock.ExpectQuery("SELECT pg_catalog.obj_description").WithArgs(`"groups"`).WillReturnRows(
+		sqlmock.NewRows([]string{"obj_description", "pg_get_partkeydef"}).AddRow(nil, nil))
+	expectPgCreateTable(mock, "users")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM \\(SELECT 1 FROM \"users\"\\) AS \"data\"").WillReturnRows(
+		sqlmock.NewRows([]string{"count"}).AddRow(1))
+	expectPgColumns(mock, "users")
+	mock.ExpectQuery("SELECT last_value, is_called FROM \"users_id_seq\"").WillReturnRows(
+		sqlmock.NewRows([]string{"last_value", "is_called"}).AddRow(1, true))
+	mock.ExpectExec("ROLLBACK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	dump := buffer.String()
+	assert.True(t, strings.HasPrefix(dump, "SET client_encoding = 'UTF8';\n"+
+		"SET standard_conforming_strings = on;\nBEGIN;\n"+
+		"DROP TYPE IF EXISTS \"mood\" CASCADE;\nCREATE TYPE \"mood\" AS ENUM ('sad', 'happy');\n"))
+	assert.Contains(t, dump, "CREATE TABLE \"groups\" (\n  \"id\" integer GENERATED BY DEFAULT AS IDENTITY NOT NULL\n);\n")
+	assert.NotContains(t, dump, "sessions")
+	assert.Contains(t, dump, pgCreateUsers+"CREATE INDEX users_domain_idx")
+	assert.Contains(t, dump, "-- Data for table \"users\" -- 1 rows\n--\n\n"+
+		"COPY \"users\" (\"id\", \"email\") FROM stdin;\n1\ta@b.c\n\\.\n")
+	assert.True(t, strings.HasSuffix(dump, "\n--\n-- Foreign keys\n--\n\n"+
+		"ALTER TABLE \"users\" ADD CONSTRAINT \"users_group_fkey\" FOREIGN KEY (group_id) REFERENCES groups(id);\n"+
+		"COMMIT;\n"))
+}
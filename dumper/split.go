@@ -0,0 +1,107 @@
+package dumper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// SplitWriter writes the dump in parts named like dump.sql.001, dump.sql.002,
+// and so on. The dump only rolls over to the next part between statements,
+// once the current part reached Size bytes, so parts may be a statement
+// larger than Size, and each one may be loaded on its own, in order. Close
+// writes the Manifest of the parts next to them, like dump.sql.manifest.
+type SplitWriter struct {
+	Path string
+	Size int64
+	// Header begins the parts after the first one, like the session settings
+	// of the dump
+	Header string
+
+	parts []ManifestPart
+	file  *os.File
+	hash  hash.Hash
+	n     int64
+}
+
+// Manifest lists the parts of a split dump
+type Manifest struct {
+	Parts []ManifestPart `json:"parts"`
+}
+
+// ManifestPart is a part of a split dump, with its file name relative to the
+// manifest
+type ManifestPart struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// NewSplitWriter returns the writer of the parts of path, of about size bytes
+func NewSplitWriter(path string, size int64) *SplitWriter {
+	return &SplitWriter{Path: path, Size: size, parts: make([]ManifestPart, 0)}
+}
+
+// Write writes to the current part, creating it if needed
+func (s *SplitWriter) Write(p []byte) (n int, err error) {
+	if s.file == nil {
+		if err = s.openPart(); err != nil {
+			return
+		}
+	}
+	n, err = s.file.Write(p)
+	s.hash.Write(p[:n])
+	s.n += int64(n)
+	return
+}
+
+func (s *SplitWriter) openPart() (err error) {
+	name := fmt.Sprintf("%s.%03d", s.Path, len(s.parts)+1)
+	if s.file, err = os.Create(name); err != nil {
+		return
+	}
+	s.hash, s.n = sha256.New(), 0
+	if len(s.parts) > 0 && s.Header != "" {
+		_, err = s.Write([]byte(s.Header))
+	}
+	return
+}
+
+// Boundary tells that the statements written so far are complete, ending the
+// current part if it's full
+func (s *SplitWriter) Boundary() error {
+	if s.file == nil || s.n < s.Size {
+		return nil
+	}
+	return s.closePart()
+}
+
+func (s *SplitWriter) closePart() error {
+	err := s.file.Close()
+	s.parts = append(s.parts, ManifestPart{
+		Name:   filepath.Base(s.file.Name()),
+		Bytes:  s.n,
+		SHA256: hex.EncodeToString(s.hash.Sum(nil)),
+	})
+	s.file = nil
+	return err
+}
+
+// Close closes the last part and writes the manifest
+func (s *SplitWriter) Close() error {
+	if s.file != nil {
+		if err := s.closePart(); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(Manifest{Parts: s.parts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path+".manifest", append(data, '\n'), 0644)
+}
@@ -0,0 +1,87 @@
+package dumper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func readManifest(t *testing.T, path string) Manifest {
+	data, err := ioutil.ReadFile(path + ".manifest")
+	assert.Nil(t, err)
+	var manifest Manifest
+	assert.Nil(t, json.Unmarshal(data, &manifest))
+	return manifest
+}
+
+func TestSplitWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	s := NewSplitWriter(path, 10)
+	s.Header = "-- part\n"
+
+	s.Write([]byte("SELECT 1;\n"))
+	s.Write([]byte("SELECT 2;\n"))
+	assert.Nil(t, s.Boundary())
+	assert.Nil(t, s.Boundary())
+	s.Write([]byte("SELECT 3;\n"))
+	assert.Nil(t, s.Close())
+
+	first, err := ioutil.ReadFile(path + ".001")
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 1;\nSELECT 2;\n", string(first))
+	second, err := ioutil.ReadFile(path + ".002")
+	assert.Nil(t, err)
+	assert.Equal(t, "-- part\nSELECT 3;\n", string(second))
+
+	firstSum, secondSum := sha256.Sum256(first), sha256.Sum256(second)
+	assert.Equal(t, Manifest{Parts: []ManifestPart{
+		{Name: "dump.sql.001", Bytes: 20, SHA256: hex.EncodeToString(firstSum[:])},
+		{Name: "dump.sql.002", Bytes: 18, SHA256: hex.EncodeToString(secondSum[:])},
+	}}, readManifest(t, path))
+}
+
+func TestMySQLDumpSplit(t *testing.T) {
+	db, mock := getDB(t)
+	path := filepath.Join(t.TempDir(), "dump.sql")
+	dumper := NewMySQLDumper(db, nil)
+	dumper.ExtendedInsertRows = 1
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).AddRow("table1", "BASE TABLE"))
+	mock.ExpectQuery("SHOW CREATE TABLE `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"Table", "Create Table"}).
+			AddRow("table1", "CREATE TABLE `table1` (`id` int)"))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(2))
+	mock.ExpectQuery("SELECT \\* FROM `table1` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery("SELECT `id` FROM `table1`").WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	s := NewSplitWriter(path, 1)
+	assert.Nil(t, dumper.Dump(context.Background(), s))
+	assert.Nil(t, s.Close())
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	manifest := readManifest(t, path)
+	assert.Len(t, manifest.Parts, 4)
+	var parts []string
+	for _, part := range manifest.Parts {
+		data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(path), part.Name))
+		assert.Nil(t, err)
+		parts = append(parts, string(data))
+	}
+	assert.True(t, strings.HasPrefix(parts[0], sqlSession))
+	assert.True(t, strings.HasSuffix(parts[0], "INSERT INTO `table1` VALUES\n( '1' );\n"))
+	assert.Equal(t, sqlSession+"INSERT INTO `table1` VALUES\n( '2' );\n", parts[1])
+	assert.Equal(t, sqlSession+"\nUNLOCK TABLES;\n", parts[2])
+	assert.Equal(t, sqlSession+"SET FOREIGN_KEY_CHECKS = 1;\n", parts[3])
+}
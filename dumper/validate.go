@@ -0,0 +1,119 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Problem is a config rule that doesn't match the live schema
+type Problem struct {
+	Section string
+	Rule    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("[%s] %s: %s", p.Section, p.Rule, p.Message)
+}
+
+// Validate checks the select, where and filter maps against the live schema.
+// Rules naming missing tables or columns, invalid filters, rules that are
+// never used because of a filter, and SQL expressions that MySQL can't
+// EXPLAIN are all reported as problems, like sensitive columns violating the
+// policy.
+func (d *mySQL) Validate(ctx context.Context) (problems []Problem, err error) {
+	tables, err := d.GetTablesContext(ctx)
+	if err != nil {
+		return
+	}
+	schema, err := d.GetColumns(ctx)
+	if err != nil {
+		return
+	}
+	names := make(map[string]string, len(tables))
+	for _, table := range tables {
+		names[strings.ToLower(table)] = table
+	}
+	report := func(section, rule, format string, args ...interface{}) {
+		problems = append(problems, Problem{section, rule, fmt.Sprintf(format, args...)})
+	}
+
+	for _, key := range sortedKeys(d.FilterMap) {
+		if _, ok := names[key]; !ok {
+			report("filter", key, "table doesn't exist")
+		}
+		if filter := d.FilterMap[key]; filter != "ignore" && filter != "nodata" {
+			report("filter", key, "invalid filter %q, expected ignore or nodata", filter)
+		}
+	}
+	for _, key := range sortedKeys(d.WhereMap) {
+		if _, ok := names[key]; !ok {
+			report("where", key, "table doesn't exist")
+		} else if filter := d.filter(key); filter == "ignore" || filter == "nodata" {
+			report("where", key, "unused, the table is filtered as %s", filter)
+		}
+	}
+	for _, key := range sortedKeys(d.SelectMap) {
+		table, ok := names[key]
+		filter := d.filter(key)
+		for _, column := range sortedKeys(d.SelectMap[key]) {
+			rule := key + "." + column
+			switch {
+			case !ok:
+				report("select", rule, "table doesn't exist")
+			case !hasColumn(schema[table], column):
+				report("select", rule, "column doesn't exist")
+			case filter == "ignore" || filter == "nodata":
+				report("select", rule, "unused, the table is filtered as %s", filter)
+			}
+		}
+	}
+
+	for _, table := range tables {
+		key := strings.ToLower(table)
+		if filter := d.filter(table); filter == "ignore" || filter == "nodata" {
+			continue
+		}
+		_, hasWhere := d.WhereMap[key]
+		if !hasWhere && len(d.SelectMap[key]) == 0 {
+			continue
+		}
+		query := d.selectQuery(table, d.selectColumns(table, columnNames(schema[table])))
+		rows, explainErr := d.DB.QueryContext(ctx, "EXPLAIN "+query)
+		if explainErr != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			report("select/where", key, "rules don't work: %s", explainErr)
+			continue
+		}
+		rows.Close()
+	}
+
+	if d.Policy != nil {
+		for _, v := range d.policyViolations(schema) {
+			report("policy", strings.ToLower(v.Table+"."+v.Column), "%s", v.Reason)
+		}
+	}
+	return
+}
+
+func hasColumn(columns []Column, name string) bool {
+	for _, column := range columns {
+		if strings.ToLower(column.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package dumper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMySQLValidate(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.FilterMap = map[string]string{"logs": "nodata", "missing": "ignore", "stats": "skip"}
+	dumper.WhereMap = map[string]string{"customer": "bogus > 10", "logs": "id > 1"}
+	dumper.SelectMap = map[string]map[string]string{
+		"customer": {"email": "'x'", "phone": "'y'"},
+		"logs":     {"message": "''"},
+	}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("customer", "BASE TABLE").
+			AddRow("logs", "BASE TABLE").
+			AddRow("stats", "BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)").
+			AddRow("customer", "email", "varchar", "varchar(255)").
+			AddRow("logs", "message", "text", "text"))
+	mock.ExpectQuery("EXPLAIN SELECT `id`, 'x' AS `email` FROM `customer` WHERE bogus > 10").
+		WillReturnError(errors.New("Unknown column 'bogus' in 'where clause'"))
+
+	problems, err := dumper.Validate(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []Problem{
+		{"filter", "missing", "table doesn't exist"},
+		{"filter", "stats", `invalid filter "skip", expected ignore or nodata`},
+		{"where", "logs", "unused, the table is filtered as nodata"},
+		{"select", "customer.phone", "column doesn't exist"},
+		{"select", "logs.message", "unused, the table is filtered as nodata"},
+		{"select/where", "customer", "rules don't work: Unknown column 'bogus' in 'where clause'"},
+	}, problems)
+	assert.Equal(t, "[filter] missing: table doesn't exist", problems[0].String())
+}
+
+func TestMySQLValidateValidConfig(t *testing.T) {
+	db, mock := getDB(t)
+	dumper := NewMySQLDumper(db, nil)
+	dumper.WhereMap = map[string]string{"customer": "id > 10"}
+
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).AddRow("customer", "BASE TABLE"))
+	mock.ExpectQuery("SELECT TABLE_NAME, COLUMN_NAME, DATA_TYPE, COLUMN_TYPE FROM information_schema.COLUMNS").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "COLUMN_NAME", "DATA_TYPE", "COLUMN_TYPE"}).
+			AddRow("customer", "id", "int", "int(11)"))
+	mock.ExpectQuery("EXPLAIN SELECT `id` FROM `customer` WHERE id > 10").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	problems, err := dumper.Validate(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Empty(t, problems)
+}
@@ -0,0 +1,170 @@
+package dumper
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// XML writes the dump like mysqldump --xml. Binary data is base64 encoded,
+// or hex encoded with Hex, and typed with an xsi:type attribute, like
+// mysqldump --hex-blob does. So are text values XML can't hold, like invalid
+// UTF-8 or control characters, which would be replaced otherwise.
+type XML struct {
+	Hex bool
+}
+
+// NewXML returns the XML dialect, with base64 encoded binary data
+func NewXML() *XML {
+	return &XML{}
+}
+
+// xmlAttrs writes the attributes of an element. Empty values are kept, as
+// mysqldump does.
+func xmlAttrs(w io.Writer, attrs ...string) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		fmt.Fprintf(w, ` %s="%s"`, attrs[i], xmlEscape(attrs[i+1]))
+	}
+}
+
+// isXMLText reports whether the value is valid UTF-8 made of characters
+// allowed in XML 1.0 documents
+func isXMLText(value []byte) bool {
+	for len(value) > 0 {
+		r, size := utf8.DecodeRune(value)
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			return false
+		case r < 0x20 && r != '\t' && r != '\n' && r != '\r',
+			r >= 0xD800 && r <= 0xDFFF, r == 0xFFFE, r == 0xFFFF:
+			return false
+		}
+		value = value[size:]
+	}
+	return true
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// Begin writes the XML declaration and opens the database element
+func (x *XML) Begin(w io.Writer, database string) {
+	fmt.Fprintf(w, "<?xml version=\"1.0\"?>\n")
+	fmt.Fprintf(w, "<mysqldump xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n")
+	fmt.Fprintf(w, "<database")
+	xmlAttrs(w, "name", database)
+	fmt.Fprintf(w, ">\n")
+}
+
+// End closes the database and mysqldump elements
+func (x *XML) End(w io.Writer) {
+	fmt.Fprintf(w, "</database>\n</mysqldump>\n")
+}
+
+// Aborted leaves the document unclosed, so it's rejected by XML parsers
+func (x *XML) Aborted(w io.Writer, err error) {
+	fmt.Fprintf(w, "<!-- Dump aborted: %s -->\n", strings.ReplaceAll(err.Error(), "--", "- -"))
+}
+
+// CreateTable writes the fields, keys and options of the table
+func (x *XML) CreateTable(w io.Writer, table *TableSchema) {
+	fmt.Fprintf(w, "\t<table_structure")
+	xmlAttrs(w, "name", table.Name)
+	fmt.Fprintf(w, ">\n")
+	for _, column := range table.Columns {
+		null := "NO"
+		if column.Nullable {
+			null = "YES"
+		}
+		fmt.Fprintf(w, "\t\t<field")
+		xmlAttrs(w, "Field", column.Name, "Type", column.Type, "Null", null, "Key", column.Key)
+		if column.Default.Valid {
+			xmlAttrs(w, "Default", column.Default.String)
+		}
+		xmlAttrs(w, "Extra", column.Extra, "Comment", column.Comment)
+		fmt.Fprintf(w, " />\n")
+	}
+	for _, index := range table.Indexes {
+		nonUnique := "1"
+		if index.Unique {
+			nonUnique = "0"
+		}
+		for i, column := range index.Columns {
+			fmt.Fprintf(w, "\t\t<key")
+			xmlAttrs(w, "Table", table.Name, "Non_unique", nonUnique, "Key_name", index.Name,
+				"Seq_in_index", fmt.Sprint(i+1), "Column_name", column)
+			fmt.Fprintf(w, " />\n")
+		}
+	}
+	fmt.Fprintf(w, "\t\t<options")
+	xmlAttrs(w, "Name", table.Name, "Engine", table.Engine, "Collation", table.Collation, "Comment", table.Comment)
+	fmt.Fprintf(w, " />\n")
+	fmt.Fprintf(w, "\t</table_structure>\n")
+}
+
+// BeginData opens the table_data element
+func (x *XML) BeginData(w io.Writer, table *TableSchema, rows uint64) {
+	fmt.Fprintf(w, "\t<table_data")
+	xmlAttrs(w, "name", table.Name)
+	fmt.Fprintf(w, ">\n")
+}
+
+// EndData closes the table_data element
+func (x *XML) EndData(w io.Writer, table *TableSchema) {
+	fmt.Fprintf(w, "\t</table_data>\n")
+}
+
+// NewRowWriter returns the writer of row elements
+func (x *XML) NewRowWriter(w io.Writer, table *TableSchema, columns []Column) (RowWriter, error) {
+	xw := &xmlWriter{XML: x, w: w, columns: columns, binary: make([]bool, len(columns))}
+	for i, column := range columns {
+		xw.binary[i] = binaryTypes[column.DataType]
+	}
+	return xw, nil
+}
+
+type xmlWriter struct {
+	*XML
+	w       io.Writer
+	columns []Column
+	binary  []bool
+}
+
+func (xw *xmlWriter) WriteRow(values []*sql.RawBytes) error {
+	var b strings.Builder
+	b.WriteString("\t<row>\n")
+	for i, value := range values {
+		b.WriteString("\t\t<field")
+		xmlAttrs(&b, "name", xw.columns[i].Name)
+		switch {
+		case value == nil:
+			b.WriteString(" xsi:nil=\"true\" />\n")
+			continue
+		case (xw.binary[i] || !isXMLText(*value)) && xw.Hex:
+			b.WriteString(" xsi:type=\"xs:hexBinary\">")
+			b.WriteString(strings.ToUpper(hex.EncodeToString(*value)))
+		case xw.binary[i] || !isXMLText(*value):
+			b.WriteString(" xsi:type=\"xs:base64Binary\">")
+			b.WriteString(base64.StdEncoding.EncodeToString(*value))
+		default:
+			b.WriteString(">")
+			xml.EscapeText(&b, *value)
+		}
+		b.WriteString("</field>\n")
+	}
+	b.WriteString("\t</row>\n")
+	_, err := io.WriteString(xw.w, b.String())
+	return err
+}
+
+func (xw *xmlWriter) Close() error {
+	return nil
+}
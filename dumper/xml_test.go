@@ -0,0 +1,94 @@
+package dumper
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXMLRowWriter(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{{Name: "id", DataType: "int"}, {Name: "note", DataType: "text"}, {Name: "photo", DataType: "blob"}}
+	rw, err := NewXML().NewRowWriter(buffer, &TableSchema{Name: "t"}, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("1", `<a href="x">&</a>`, "\x00\xff")))
+	assert.Nil(t, rw.WriteRow(rawBytes("2", nil, nil)))
+	assert.Nil(t, rw.Close())
+	assert.Equal(t, "\t<row>\n"+
+		"\t\t<field name=\"id\">1</field>\n"+
+		"\t\t<field name=\"note\">&lt;a href=&#34;x&#34;&gt;&amp;&lt;/a&gt;</field>\n"+
+		"\t\t<field name=\"photo\" xsi:type=\"xs:base64Binary\">AP8=</field>\n"+
+		"\t</row>\n"+
+		"\t<row>\n"+
+		"\t\t<field name=\"id\">2</field>\n"+
+		"\t\t<field name=\"note\" xsi:nil=\"true\" />\n"+
+		"\t\t<field name=\"photo\" xsi:nil=\"true\" />\n"+
+		"\t</row>\n", buffer.String())
+
+	buffer.Reset()
+	rw, _ = (&XML{Hex: true}).NewRowWriter(buffer, &TableSchema{Name: "t"}, columns)
+	assert.Nil(t, rw.WriteRow(rawBytes("3", "", "\x00\xff")))
+	assert.Contains(t, buffer.String(), "<field name=\"note\"></field>\n")
+	assert.Contains(t, buffer.String(), "<field name=\"photo\" xsi:type=\"xs:hexBinary\">00FF</field>\n")
+}
+
+func TestXMLRowWriterEncodesInvalidText(t *testing.T) {
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	columns := []Column{{Name: "latin1", DataType: "varchar"}, {Name: "control", DataType: "text"},
+		{Name: "plain", DataType: "text"}}
+	rw, err := NewXML().NewRowWriter(buffer, &TableSchema{Name: "t"}, columns)
+	assert.Nil(t, err)
+	assert.Nil(t, rw.WriteRow(rawBytes("caf\xe9", "a\x01b", "tab\tnewline\ncafé")))
+	assert.Equal(t, "\t<row>\n"+
+		"\t\t<field name=\"latin1\" xsi:type=\"xs:base64Binary\">Y2Fm6Q==</field>\n"+
+		"\t\t<field name=\"control\" xsi:type=\"xs:base64Binary\">YQFi</field>\n"+
+		"\t\t<field name=\"plain\">tab&#x9;newline&#xA;café</field>\n"+
+		"\t</row>\n", buffer.String())
+
+	buffer.Reset()
+	rw, _ = (&XML{Hex: true}).NewRowWriter(buffer, &TableSchema{Name: "t"}, columns)
+	assert.Nil(t, rw.WriteRow(rawBytes("caf\xe9", "", "")))
+	assert.Contains(t, buffer.String(), "<field name=\"latin1\" xsi:type=\"xs:hexBinary\">636166E9</field>\n")
+}
+
+func TestMySQLDumpWithXML(t *testing.T) {
+	db, mock := getDB(t)
+	buffer := bytes.NewBuffer(make([]byte, 0))
+	dumper := NewMySQLDumper(db, nil)
+	dumper.Dialect = NewXML()
+
+	mock.ExpectQuery("SELECT DATABASE\\(\\)").WillReturnRows(
+		sqlmock.NewRows([]string{"DATABASE()"}).AddRow("shop"))
+	mock.ExpectQuery("SHOW FULL TABLES").WillReturnRows(
+		sqlmock.NewRows([]string{"Tables_in_database", "Table_type"}).
+			AddRow("people", "BASE TABLE"))
+	expectTableSchema(mock, "people")
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `people` LIMIT 1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Ann"))
+	mock.ExpectQuery("SELECT `id`, `name` FROM `people`").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Ann"))
+
+	assert.Nil(t, dumper.Dump(context.Background(), buffer))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	xml := buffer.String()
+	assert.True(t, strings.HasPrefix(xml, "<?xml version=\"1.0\"?>\n"+
+		"<mysqldump xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n"+
+		"<database name=\"shop\">\n"+
+		"\t<table_structure name=\"people\">\n"))
+	assert.Contains(t, xml, "\t\t<field Field=\"id\" Type=\"int(11)\" Null=\"NO\" Key=\"PRI\" "+
+		"Extra=\"auto_increment\" Comment=\"\" />\n")
+	assert.Contains(t, xml, "\t\t<field Field=\"name\" Type=\"varchar(50)\" Null=\"YES\" Key=\"MUL\" "+
+		"Default=\"unknown\" Extra=\"\" Comment=\"Full name\" />\n")
+	assert.Contains(t, xml, "\t\t<key Table=\"people\" Non_unique=\"1\" Key_name=\"name_id\" "+
+		"Seq_in_index=\"2\" Column_name=\"id\" />\n")
+	assert.Contains(t, xml, "\t\t<options Name=\"people\" Engine=\"InnoDB\" Collation=\"utf8mb4_general_ci\" "+
+		"Comment=\"People &amp; pets\" />\n")
+	assert.Contains(t, xml, "\t<table_data name=\"people\">\n\t<row>\n\t\t<field name=\"id\">1</field>\n")
+	assert.True(t, strings.HasSuffix(xml, "\t</table_data>\n</database>\n</mysqldump>\n"))
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/hgfischer/mysqlsuperdump/dumper"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
 func main() {
@@ -16,26 +24,181 @@ func main() {
 	}
 
 	cfg := newConfig()
-	checkError(cfg.parseAll())
-	verbosely := cfg.getVerboseLogger()
-
-	verbosely.Println("Connecting to MySQL database at", cfg.dsn)
-	db, err := sql.Open("mysql", cfg.dsn)
-	db.SetMaxOpenConns(cfg.maxOpenConns)
+	checkError(cfg.parseAll(os.Args[1:]))
+	logger, err := cfg.getLogger()
 	checkError(err)
-	defer db.Close()
+	checkError = func(err error) {
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
 
-	dumpr := dumper.NewMySQLDumper(db, verbosely)
-	dumpr.SelectMap = cfg.selectMap
-	dumpr.WhereMap = cfg.whereMap
-	dumpr.FilterMap = cfg.filterMap
-	dumpr.UseTableLock = cfg.useTableLock
-	dumpr.ExtendedInsertRows = cfg.extendedInsRows
+	if cfg.command == CommandConvert {
+		w, err := cfg.initOutput(0)
+		checkError(err)
+		defer w.Close()
+		checkError(cfg.writeYAML(w))
+		return
+	}
 
-	w, err := cfg.initOutput()
-	checkError(err)
-	defer w.Close()
+	// The first SIGINT/SIGTERM cancels the dump gracefully. Once it is
+	// caught, the default behavior is restored, so a second one kills us.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	rules := dumper.Rules{
+		SelectMap:     cfg.selectMap,
+		WhereMap:      cfg.whereMap,
+		FilterMap:     cfg.filterMap,
+		SampleMap:     cfg.sampleMap,
+		Tables:        cfg.tables,
+		ExcludeTables: cfg.excludeTables,
+	}
+	var dumpr dumper.Dumper
+	var observers *[]dumper.Observer
+	var report *dumper.Report
+	var offset int64
+	// copyTo replaces the dump with the copy command
+	var copyTo func(ctx context.Context) error
+	if cfg.postgresDSN != "" {
+		pgConfig, err := pgx.ParseConfig(cfg.postgresDSN)
+		checkError(err)
+		logger.Info("Connecting to PostgreSQL database", "host", pgConfig.Host, "database", pgConfig.Database)
+		db := stdlib.OpenDB(*pgConfig)
+		db.SetMaxOpenConns(cfg.maxOpenConns)
+		defer db.Close()
+
+		pg := dumper.NewPostgreSQLDumper(db, logger)
+		pg.Rules = rules
+		pg.UseTableLock = cfg.useTableLock
+		dumpr, observers = pg, &pg.Observers
+	} else {
+		logger.Info("Connecting to MySQL database", "addr", cfg.mysql.Addr, "database", cfg.mysql.DBName)
+		connector, err := mysql.NewConnector(cfg.mysql)
+		checkError(err)
+		db := sql.OpenDB(connector)
+		db.SetMaxOpenConns(cfg.maxOpenConns)
+		defer db.Close()
+
+		my := dumper.NewMySQLDumper(db, logger)
+		my.Rules = rules
+		my.InsertRowsMap = cfg.insertRowsMap
+		my.Format, err = cfg.getFormat()
+		checkError(err)
+		my.DataDir = cfg.getDataDir()
+		my.Dialect, err = cfg.getDialect()
+		checkError(err)
+		my.UseTableLock = cfg.useTableLock
+		my.ExtendedInsertRows = cfg.extendedInsRows
+		my.ChunkSize = cfg.chunkSize
+		my.Retry = cfg.retry
+		my.Policy = cfg.policy
+		dumpr, observers = my, &my.Observers
+
+		if cfg.command == CommandValidate {
+			problems, err := my.Validate(ctx)
+			checkError(err)
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			if len(problems) > 0 {
+				os.Exit(1)
+			}
+			fmt.Println("Config is valid")
+			return
+		}
+
+		if cfg.command == CommandScan {
+			findings, err := my.Scan(ctx, cfg.scanRows)
+			checkError(err)
+			w, err := cfg.initOutput(0)
+			checkError(err)
+			defer w.Close()
+			dumper.WriteScanConfig(w, findings)
+			return
+		}
+
+		if cfg.dryRun {
+			checkError(my.Plan(ctx, os.Stdout))
+			return
+		}
+
+		if cfg.command == CommandCopy {
+			logger.Info("Connecting to target MySQL database", "addr", cfg.target.Addr, "database", cfg.target.DBName)
+			connector, err := mysql.NewConnector(cfg.target)
+			checkError(err)
+			target := sql.OpenDB(connector)
+			target.SetMaxOpenConns(cfg.copyWorkers)
+			defer target.Close()
+			copyTo = func(ctx context.Context) error {
+				return my.Copy(ctx, target, cfg.copyOptions())
+			}
+		}
 
-	verbosely.Println("Starting dump")
-	checkError(dumpr.Dump(w))
+		if cfg.checkpoint != "" {
+			logger.Info("Using checkpoint", "path", cfg.checkpoint, "resume", cfg.resume)
+			my.Checkpoint, err = my.OpenCheckpoint(ctx, cfg.checkpoint, cfg.fileHash, cfg.resume)
+			checkError(err)
+			offset = my.Checkpoint.Offset
+		}
+
+		if cfg.report != "" {
+			report, err = my.NewReport(ctx)
+			checkError(err)
+			report.ConfigHash = cfg.fileHash
+		}
+	}
+	if progress := cfg.getProgress(); progress != nil {
+		*observers = append(*observers, progress)
+	}
+
+	var metrics *metrics
+	if cfg.metricsAddr != "" || cfg.metricsPushURL != "" {
+		metrics = newMetrics()
+		*observers = append(*observers, metrics)
+	}
+	if cfg.metricsAddr != "" {
+		logger.Info("Exposing metrics", "addr", cfg.metricsAddr)
+		checkError(metrics.serve(cfg.metricsAddr))
+	}
+
+	if report != nil {
+		*observers = append(*observers, report)
+	}
+
+	name := "Dump"
+	if copyTo != nil {
+		name = "Copy"
+		logger.Info("Starting copy", "target", cfg.target.Addr)
+		err = copyTo(ctx)
+	} else {
+		var w io.WriteCloser
+		w, err = cfg.initOutput(offset)
+		checkError(err)
+
+		logger.Info("Starting dump", "output", cfg.output)
+		err = dumpr.Dump(ctx, w)
+		// Closing a split output writes its manifest
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if report != nil {
+		logger.Info("Writing report", "path", cfg.report)
+		checkError(report.WriteFile(cfg.report))
+	}
+	if cfg.metricsPushURL != "" {
+		logger.Info("Pushing metrics", "url", cfg.metricsPushURL)
+		checkError(metrics.push(cfg.metricsPushURL))
+	}
+	if ctx.Err() != nil {
+		logger.Error(name+" aborted", "error", err)
+		os.Exit(1)
+	}
+	checkError(err)
+	logger.Info(name + " finished")
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// metrics is a dumper.Observer exposing the dump progress to Prometheus
+type metrics struct {
+	registry      *prometheus.Registry
+	rows          *prometheus.CounterVec
+	bytes         *prometheus.CounterVec
+	currentTable  *prometheus.GaugeVec
+	expectedRows  *prometheus.GaugeVec
+	queryDuration *prometheus.HistogramVec
+	lockHeld      prometheus.Histogram
+	errors        *prometheus.CounterVec
+	started       prometheus.Gauge
+	finished      prometheus.Gauge
+	succeeded     prometheus.Gauge
+	tableFailed   bool
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mysqlsuperdump_rows_dumped_total",
+			Help: "Rows dumped, by table.",
+		}, []string{"table"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mysqlsuperdump_bytes_dumped_total",
+			Help: "Bytes of table data dumped, by table.",
+		}, []string{"table"}),
+		currentTable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mysqlsuperdump_current_table",
+			Help: "Set to 1 for the table being dumped.",
+		}, []string{"table"}),
+		expectedRows: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "mysqlsuperdump_table_rows_expected",
+			Help: "Rows expected to be dumped, by table.",
+		}, []string{"table"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mysqlsuperdump_query_duration_seconds",
+			Help:    "Latency of the queries reading the data, by kind of query.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"query"}),
+		lockHeld: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "mysqlsuperdump_lock_held_seconds",
+			Help:    "Time tables were kept locked for reading.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "mysqlsuperdump_errors_total",
+			Help: "Errors, by table. Errors not related to a table have an empty label.",
+		}, []string{"table"}),
+		started: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mysqlsuperdump_start_time_seconds",
+			Help: "Unix time the dump started.",
+		}),
+		finished: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mysqlsuperdump_finish_time_seconds",
+			Help: "Unix time the dump finished.",
+		}),
+		succeeded: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "mysqlsuperdump_success",
+			Help: "Set to 1 if the dump finished successfully.",
+		}),
+	}
+	m.registry.MustRegister(m.rows, m.bytes, m.currentTable, m.expectedRows, m.queryDuration,
+		m.lockHeld, m.errors, m.started, m.finished, m.succeeded)
+	return m
+}
+
+// serve exposes the metrics at http://addr/metrics in background
+func (m *metrics) serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	go http.Serve(listener, mux)
+	return nil
+}
+
+// push sends the metrics to a Pushgateway compatible endpoint
+func (m *metrics) push(url string) error {
+	return push.New(url, "mysqlsuperdump").Gatherer(m.registry).Push()
+}
+
+func (m *metrics) DumpStarted(estimatedRows map[string]uint64) {
+	m.started.SetToCurrentTime()
+	for table, rows := range estimatedRows {
+		m.expectedRows.WithLabelValues(table).Set(float64(rows))
+	}
+}
+
+func (m *metrics) TableSkipped(table, filter string) {}
+
+func (m *metrics) TableStarted(table string, rows uint64) {
+	m.currentTable.WithLabelValues(table).Set(1)
+	if rows > 0 {
+		m.expectedRows.WithLabelValues(table).Set(float64(rows))
+	}
+}
+
+func (m *metrics) RowsDumped(table string, rows, bytes uint64) {
+	m.rows.WithLabelValues(table).Add(float64(rows))
+	m.bytes.WithLabelValues(table).Add(float64(bytes))
+}
+
+func (m *metrics) TableFinished(table string, err error) {
+	m.currentTable.DeleteLabelValues(table)
+	if err != nil {
+		m.errors.WithLabelValues(table).Inc()
+		m.tableFailed = true
+	}
+}
+
+func (m *metrics) DumpFinished(err error) {
+	m.finished.SetToCurrentTime()
+	if err != nil {
+		// Errors of a table were already counted when it finished
+		if !m.tableFailed {
+			m.errors.WithLabelValues("").Inc()
+		}
+		return
+	}
+	m.succeeded.Set(1)
+}
+
+func (m *metrics) QueryDone(kind string, duration time.Duration, err error) {
+	m.queryDuration.WithLabelValues(kind).Observe(duration.Seconds())
+}
+
+func (m *metrics) LockReleased(table string, held time.Duration) {
+	m.lockHeld.Observe(held.Seconds())
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// defaultOptionFiles are read in order, like the MySQL clients do, unless
+// -defaults-file or -no-defaults are given
+var defaultOptionFiles = []string{"/etc/my.cnf", "/etc/mysql/my.cnf", "~/.my.cnf"}
+
+// mysqlOptions are the options read from the [client] and [mysqldump] groups
+// of MySQL option files, with their names normalized to use dashes
+type mysqlOptions map[string]string
+
+// readOptionFiles reads the options of groups from files. Files read later,
+// and groups listed later, override the previous ones. Only the default
+// option files may be missing.
+func readOptionFiles(files []string, groups []string, optional bool) (mysqlOptions, error) {
+	options := make(mysqlOptions)
+	for _, file := range files {
+		if strings.HasPrefix(file, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			file = filepath.Join(home, file[2:])
+		}
+		if err := options.readFile(file, groups); err != nil {
+			if optional && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+// readFile reads an option file, following its !include and !includedir
+// directives
+func (o mysqlOptions) readFile(file string, groups []string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// Options of each group are applied in the order of groups
+	read := make(map[string]mysqlOptions)
+	var group string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case strings.HasPrefix(line, "!includedir "):
+			dir := strings.TrimSpace(strings.TrimPrefix(line, "!includedir "))
+			includes, _ := filepath.Glob(filepath.Join(dir, "*.cnf"))
+			for _, include := range includes {
+				if err = o.readFile(include, groups); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(line, "!include "):
+			if err = o.readFile(strings.TrimSpace(strings.TrimPrefix(line, "!include ")), groups); err != nil {
+				return err
+			}
+		case line[0] == '[' && line[len(line)-1] == ']':
+			group = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+		default:
+			name, value := parseOption(line)
+			if read[group] == nil {
+				read[group] = make(mysqlOptions)
+			}
+			read[group][name] = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for name, value := range read[group] {
+			o[name] = value
+		}
+	}
+	return nil
+}
+
+// parseOption parses name = value lines. Options without value, like
+// skip-ssl, are set to an empty string.
+func parseOption(line string) (name, value string) {
+	name = line
+	if i := strings.Index(line, "="); i >= 0 {
+		name, value = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return name, value[1 : len(value)-1]
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return
+}
+
+// mysqlConfig builds the connection settings. The DSN of the config file, if
+// any, is merged over the MySQL option files, so settings missing from it,
+// like the address or the password, come from them. Like the MySQL clients,
+// the MYSQL_PWD environment variable is only used when neither sets a
+// password. The -password-file flag overrides them all. The obfuscated
+// .mylogin.cnf login path file isn't read.
+func (c *config) mysqlConfig() (*mysql.Config, error) {
+	var options mysqlOptions
+	if !c.noDefaults {
+		var groups []string
+		for _, group := range []string{"client", "mysqldump"} {
+			groups = append(groups, group)
+			if c.defaultsGroupSuffix != "" {
+				groups = append(groups, group+c.defaultsGroupSuffix)
+			}
+		}
+		files, optional := defaultOptionFiles, true
+		if c.defaultsFile != "" {
+			files, optional = []string{c.defaultsFile}, false
+		}
+		var err error
+		if options, err = readOptionFiles(files, groups, optional); err != nil {
+			return nil, err
+		}
+	}
+	if c.dsn == "" && len(options) == 0 {
+		return nil, errors.New("Missing dsn option of the mysql section in " + c.file + ", -dsn flag or MySQL option files")
+	}
+
+	var err error
+	mc := mysql.NewConfig()
+	if c.dsn != "" {
+		if mc, err = mysql.ParseDSN(c.dsn); err != nil {
+			return nil, err
+		}
+	}
+	// The password of another user is no use
+	if mc.Passwd == "" && (mc.User == "" || options["user"] == "" || mc.User == options["user"]) {
+		mc.Passwd = options["password"]
+	}
+	if mc.User == "" {
+		mc.User = options["user"]
+	}
+	if mc.DBName == "" {
+		mc.DBName = options["database"]
+	}
+	if !dsnHasAddr(c.dsn) {
+		host, port := options["host"], options["port"]
+		// Like the MySQL clients, localhost means the socket
+		if socket := options["socket"]; socket != "" && (host == "" || host == "localhost") {
+			mc.Net, mc.Addr = "unix", socket
+		} else if host != "" || port != "" {
+			if host == "" {
+				host = "127.0.0.1"
+			}
+			if port == "" {
+				port = "3306"
+			}
+			mc.Net, mc.Addr = "tcp", net.JoinHostPort(host, port)
+		}
+	}
+	if mc.TLSConfig == "" && mc.TLS == nil {
+		if strings.EqualFold(options["ssl-mode"], "PREFERRED") {
+			mc.TLSConfig = "preferred"
+		} else if mc.TLS, err = options.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	if password, ok := os.LookupEnv("MYSQL_PWD"); ok && mc.Passwd == "" {
+		mc.Passwd = password
+	}
+	if c.passwordFile != "" {
+		data, err := ioutil.ReadFile(c.passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		mc.Passwd = strings.TrimRight(string(data), "\r\n")
+	}
+	return mc, nil
+}
+
+// dsnHasAddr reports whether the DSN sets the address, like the MySQL
+// driver parses it: [user[:password]@][net[(addr)]]/dbname[?params]
+func dsnHasAddr(dsn string) bool {
+	slash := strings.LastIndex(dsn, "/")
+	if slash < 0 {
+		return false
+	}
+	return strings.Contains(dsn[strings.LastIndex(dsn[:slash], "@")+1:slash], "(")
+}
+
+// tlsConfig maps the ssl-mode, ssl-ca, ssl-cert and ssl-key options to a TLS
+// config. Like the MySQL clients, a CA without ssl-mode means VERIFY_CA.
+func (o mysqlOptions) tlsConfig() (*tls.Config, error) {
+	mode := strings.ToUpper(o["ssl-mode"])
+	if mode == "" && o["ssl-ca"] != "" {
+		mode = "VERIFY_CA"
+	}
+	if _, ok := o["skip-ssl"]; ok {
+		mode = "DISABLED"
+	}
+	config := &tls.Config{}
+	switch mode {
+	case "", "DISABLED":
+		return nil, nil
+	case "REQUIRED":
+		config.InsecureSkipVerify = true
+	case "VERIFY_CA", "VERIFY_IDENTITY":
+		if o["ssl-ca"] == "" {
+			return nil, errors.New("MySQL option ssl-mode=" + mode + " requires ssl-ca")
+		}
+		pem, err := ioutil.ReadFile(o["ssl-ca"])
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificates found in ssl-ca " + o["ssl-ca"])
+		}
+		if mode == "VERIFY_CA" {
+			// Verify the chain, but not the host name
+			config.InsecureSkipVerify = true
+			config.VerifyPeerCertificate = verifyChain(config.RootCAs)
+		}
+	default:
+		return nil, errors.New("Invalid MySQL option ssl-mode: " + mode)
+	}
+	if o["ssl-cert"] != "" || o["ssl-key"] != "" {
+		cert, err := tls.LoadX509KeyPair(o["ssl-cert"], o["ssl-key"])
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		var certs []*x509.Certificate
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) == 0 {
+			return errors.New("MySQL server sent no certificate")
+		}
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+		return err
+	}
+}